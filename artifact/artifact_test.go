@@ -0,0 +1,178 @@
+package artifact
+
+import (
+	"github.com/mewa/djinn/djinn/job"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFS(t *testing.T) (*FS, string) {
+	dir, err := ioutil.TempDir("", "djinn-artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := NewFS(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return fs, dir
+}
+
+func Test_Key(t *testing.T) {
+	key, err := Key("reports/daily", 100, "report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, tm, name, err := ParseKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "reports/daily" || tm != 100 || name != "report.csv" {
+		t.Fatalf("invalid key: id='%s', time='%d', name='%s'", id, tm, name)
+	}
+
+	for _, name := range []string{"", "..", "a/b"} {
+		if _, err := Key("job", 100, name); err != ErrInvalidName {
+			t.Fatalf("invalid error for '%s': expected='%v', actual='%v'", name, ErrInvalidName, err)
+		}
+	}
+
+	for _, id := range []job.ID{"", ".", ".."} {
+		if _, err := Key(id, 100, "out.log"); err != ErrInvalidID {
+			t.Fatalf("invalid error for '%s': expected='%v', actual='%v'", id, ErrInvalidID, err)
+		}
+	}
+
+	for _, key := range []string{"/100/out.log", "./100/out.log", "../100/out.log"} {
+		if _, _, _, err := ParseKey(key); err != ErrInvalidKey {
+			t.Fatalf("invalid error for '%s': expected='%v', actual='%v'", key, ErrInvalidKey, err)
+		}
+	}
+}
+
+func Test_FS(t *testing.T) {
+	fs, dir := newFS(t)
+	defer os.RemoveAll(dir)
+
+	key, _ := Key("job", 100, "out.log")
+	n, err := fs.Put(key, strings.NewReader("output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Fatalf("invalid size: expected='6', actual='%d'", n)
+	}
+
+	blob, err := fs.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(blob)
+	blob.Close()
+	if string(data) != "output" {
+		t.Fatalf("invalid blob: expected='output', actual='%s'", data)
+	}
+
+	infos, err := fs.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Key != key || infos[0].Size != 6 {
+		t.Fatalf("invalid listing: %v", infos)
+	}
+
+	if _, err := fs.Put("../100/out.log", strings.NewReader("output")); err != ErrInvalidKey {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrInvalidKey, err)
+	}
+
+	if err := fs.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Get(key); err != ErrNotFound {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrNotFound, err)
+	}
+
+	// empty directories are removed with the blob
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Fatalf("directories left behind: %d", len(files))
+	}
+}
+
+func Test_Prune(t *testing.T) {
+	fs, dir := newFS(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Unix(1000, 0)
+	blobs := []struct {
+		id string
+		t  int64
+	}{
+		{"a", 100},
+		{"a", 900},
+		{"a", 950},
+		{"a", 990},
+		{"b", 990},
+	}
+	for _, b := range blobs {
+		key, _ := Key(job.ID(b.id), b.t, "out.log")
+		fs.Put(key, strings.NewReader("output"))
+	}
+
+	removed, err := Prune(fs, Retention{MaxAge: 500 * time.Second, MaxExecutions: 2}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// expired one and one exceeding the limit
+	if removed != 2 {
+		t.Fatalf("invalid number of removed artifacts: expected='2', actual='%d'", removed)
+	}
+
+	infos, _ := fs.List()
+	var keys []string
+	for _, info := range infos {
+		keys = append(keys, info.Key)
+	}
+	expected := "a/950/out.log a/990/out.log b/990/out.log"
+	if strings.Join(keys, " ") != expected {
+		t.Fatalf("invalid artifacts kept: expected='%s', actual='%s'", expected, strings.Join(keys, " "))
+	}
+}
+
+func Test_RemoveExecutions(t *testing.T) {
+	fs, dir := newFS(t)
+	defer os.RemoveAll(dir)
+
+	for _, tm := range []int64{100, 200} {
+		for _, name := range []string{"out.log", "report.csv"} {
+			key, _ := Key("job", tm, name)
+			fs.Put(key, strings.NewReader("output"))
+		}
+	}
+
+	removed, err := RemoveExecutions(fs, func(id job.ID, t int64) bool {
+		return id == "job" && t == 100
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Fatalf("invalid number of removed artifacts: expected='2', actual='%d'", removed)
+	}
+
+	infos, _ := fs.List()
+	for _, info := range infos {
+		if _, tm, _, _ := ParseKey(info.Key); tm != 200 {
+			t.Fatalf("invalid artifacts kept: %v", infos)
+		}
+	}
+	if len(infos) != 2 {
+		t.Fatalf("invalid artifacts kept: %v", infos)
+	}
+}
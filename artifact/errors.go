@@ -0,0 +1,12 @@
+package artifact
+
+import (
+	"errors"
+)
+
+var (
+	ErrNotFound    = errors.New("artifact not found")
+	ErrInvalidName = errors.New("invalid artifact name")
+	ErrInvalidKey  = errors.New("invalid artifact key")
+	ErrInvalidID   = errors.New("job id can't be used in artifact keys")
+)
@@ -0,0 +1,144 @@
+package artifact
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// suffix of blobs being written
+const partial = ".partial"
+
+// FS stores blobs as files in a directory, so they can only be
+// downloaded from the node which stored them unless the directory is
+// shared.
+type FS struct {
+	dir string
+}
+
+func NewFS(dir string) (*FS, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FS{dir}, nil
+}
+
+func (fs *FS) path(key string) (string, error) {
+	if _, _, _, err := ParseKey(key); err != nil {
+		return "", err
+	}
+
+	// valid keys can't step out of dir, this guards against ones which
+	// the file system reads differently
+	path := filepath.Join(fs.dir, filepath.FromSlash(key))
+	rel, err := filepath.Rel(fs.dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidKey
+	}
+	return path, nil
+}
+
+// implements artifact.Store, blobs only become visible once they're
+// fully written
+func (fs *FS) Put(key string, blob io.Reader) (int64, error) {
+	path, err := fs.path(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*"+partial)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(f, blob)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	return n, nil
+}
+
+// implements artifact.Store
+func (fs *FS) Get(key string) (io.ReadCloser, error) {
+	path, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// implements artifact.Store, directories left empty are removed
+func (fs *FS) Delete(key string) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// fails unless they're empty
+	dir := filepath.Dir(path)
+	if os.Remove(dir) == nil {
+		os.Remove(filepath.Dir(dir))
+	}
+	return nil
+}
+
+// implements artifact.Store
+func (fs *FS) List() ([]Info, error) {
+	var infos []Info
+	err := filepath.Walk(fs.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, partial) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(fs.dir, path)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if _, _, _, err := ParseKey(key); err != nil {
+			// not a blob
+			return nil
+		}
+
+		infos = append(infos, Info{
+			Key:     key,
+			Size:    info.Size(),
+			Created: info.ModTime(),
+		})
+		return nil
+	})
+	return infos, err
+}
@@ -0,0 +1,104 @@
+package artifact
+
+import (
+	"github.com/mewa/djinn/djinn/job"
+	"sort"
+	"time"
+)
+
+// Retention decides which artifacts are kept, zero fields don't limit
+// them.
+type Retention struct {
+	// artifacts of executions older than MaxAge are removed
+	MaxAge time.Duration
+
+	// only artifacts of the latest MaxExecutions executions of every
+	// job are kept
+	MaxExecutions int
+}
+
+// Prune removes the artifacts the retention doesn't keep at the given
+// time, returning how many it removed.
+func Prune(store Store, r Retention, now time.Time) (int, error) {
+	infos, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	type blob struct {
+		key string
+		id  job.ID
+		t   int64
+	}
+
+	var blobs []blob
+	executions := map[job.ID]map[int64]bool{}
+	for _, info := range infos {
+		id, t, _, err := ParseKey(info.Key)
+		if err != nil {
+			continue
+		}
+
+		blobs = append(blobs, blob{info.Key, id, t})
+		if executions[id] == nil {
+			executions[id] = map[int64]bool{}
+		}
+		executions[id][t] = true
+	}
+
+	kept := map[job.ID]map[int64]bool{}
+	for id, set := range executions {
+		var ts []int64
+		for t := range set {
+			ts = append(ts, t)
+		}
+
+		// latest first
+		sort.Slice(ts, func(i, j int) bool { return ts[i] > ts[j] })
+		if r.MaxExecutions > 0 && len(ts) > r.MaxExecutions {
+			ts = ts[:r.MaxExecutions]
+		}
+
+		kept[id] = map[int64]bool{}
+		for _, t := range ts {
+			kept[id][t] = true
+		}
+	}
+
+	var removed int
+	for _, b := range blobs {
+		expired := r.MaxAge > 0 && now.Sub(time.Unix(b.t, 0)) > r.MaxAge
+		if !expired && kept[b.id][b.t] {
+			continue
+		}
+
+		if err := store.Delete(b.key); err != nil && err != ErrNotFound {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RemoveExecutions removes the artifacts of the executions of jobs
+// matched by removed, returning how many it removed.
+func RemoveExecutions(store Store, removed func(id job.ID, t int64) bool) (int, error) {
+	infos, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, info := range infos {
+		id, t, _, err := ParseKey(info.Key)
+		if err != nil || !removed(id, t) {
+			continue
+		}
+
+		if err := store.Delete(info.Key); err != nil && err != ErrNotFound {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,73 @@
+// Package artifact stores blobs attached to executions, which are too
+// large to be kept with the rest of their results.
+package artifact
+
+import (
+	"fmt"
+	"github.com/mewa/djinn/djinn/job"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Store keeps blobs under keys made with Key.
+type Store interface {
+	// Put stores the blob, returning its size.
+	Put(key string, blob io.Reader) (int64, error)
+
+	// Get returns the stored blob, or ErrNotFound.
+	Get(key string) (io.ReadCloser, error)
+
+	Delete(key string) error
+
+	// List returns all stored blobs.
+	List() ([]Info, error)
+}
+
+// Info describes a stored blob.
+type Info struct {
+	Key     string
+	Size    int64
+	Created time.Time
+}
+
+// Key returns the key of the artifact attached to the execution of the
+// job at time t. Ids which escape to "", "." or ".." are rejected.
+func Key(id job.ID, t int64, name string) (string, error) {
+	if !validName(name) {
+		return "", ErrInvalidName
+	}
+
+	escaped := url.PathEscape(string(id))
+	if !validName(escaped) {
+		return "", ErrInvalidID
+	}
+	return fmt.Sprintf("%s/%d/%s", escaped, t, name), nil
+}
+
+// ParseKey returns the job, execution time and name of the artifact
+// stored under key.
+func ParseKey(key string) (job.ID, int64, string, error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 || !validName(parts[0]) || !validName(parts[2]) {
+		return "", 0, "", ErrInvalidKey
+	}
+
+	id, err := url.PathUnescape(parts[0])
+	if err != nil {
+		return "", 0, "", ErrInvalidKey
+	}
+
+	t, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, "", ErrInvalidKey
+	}
+	return job.ID(id), t, parts[2], nil
+}
+
+// names are used as file names by the file system store
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\\x00")
+}
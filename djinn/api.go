@@ -33,6 +33,12 @@ type AddMemberResponse struct {
 }
 
 func (d *Djinn) Put(req *JobPutRequest) (*JobPutResponse, error) {
+	return d.putIf(req, 0)
+}
+
+// putIf puts the job only if its key wasn't modified since revision rev,
+// returning ErrJobModified otherwise. A zero rev puts it unconditionally.
+func (d *Djinn) putIf(req *JobPutRequest, rev int64) (*JobPutResponse, error) {
 	if req.Id == 0 {
 		req.Id = d.idGen.Next()
 	}
@@ -45,11 +51,31 @@ func (d *Djinn) Put(req *JobPutRequest) (*JobPutResponse, error) {
 	ctx, _ := context.WithTimeout(context.TODO(), time.Millisecond*time.Duration(3*d.config.ElectionMs))
 	ch := d.wait.Register(req.Id)
 
-	_, err = d.etcd.Server.Put(ctx, &etcdserverpb.PutRequest{
+	put := &etcdserverpb.PutRequest{
 		Key:    []byte(req.Job.ID),
 		Value:  val,
 		PrevKv: true,
-	})
+	}
+
+	if rev == 0 {
+		_, err = d.etcd.Server.Put(ctx, put)
+	} else {
+		var resp *etcdserverpb.TxnResponse
+		resp, err = d.etcd.Server.Txn(ctx, &etcdserverpb.TxnRequest{
+			Compare: []*etcdserverpb.Compare{{
+				Key:         put.Key,
+				Target:      etcdserverpb.Compare_MOD,
+				Result:      etcdserverpb.Compare_EQUAL,
+				TargetUnion: &etcdserverpb.Compare_ModRevision{ModRevision: rev},
+			}},
+			Success: []*etcdserverpb.RequestOp{{
+				Request: &etcdserverpb.RequestOp_RequestPut{RequestPut: put},
+			}},
+		})
+		if err == nil && !resp.Succeeded {
+			err = ErrJobModified
+		}
+	}
 
 	if err != nil {
 		d.wait.Trigger(req.Id, nil)
@@ -0,0 +1,62 @@
+package djinn
+
+import (
+	"github.com/mewa/djinn/artifact"
+	"github.com/mewa/djinn/djinn/job"
+	"go.uber.org/zap"
+	"io"
+	"time"
+)
+
+// UseArtifacts stores artifacts attached to executions in store. It has
+// to be called before Start, without a store attached blobs are
+// discarded.
+func (d *Djinn) UseArtifacts(store artifact.Store) {
+	d.artifacts = store
+}
+
+// storeArtifacts stores blobs attached to the result, replacing them with
+// references
+func (d *Djinn) storeArtifacts(id job.ID, res *job.Result) {
+	for i := range res.Artifacts {
+		a := &res.Artifacts[i]
+		if a.Blob == nil {
+			continue
+		}
+
+		err := ErrNoArtifactStore
+		if d.artifacts != nil {
+			var key string
+			key, err = artifact.Key(id, res.Time, a.Name)
+			if err == nil {
+				a.Size, err = d.artifacts.Put(key, a.Blob)
+			}
+			if err == nil {
+				a.Key = key
+			}
+		}
+
+		if c, ok := a.Blob.(io.Closer); ok {
+			c.Close()
+		}
+		a.Blob = nil
+
+		if err != nil {
+			d.log.Error("could not store artifact", zap.String("name", d.config.Name), zap.String("job_id", string(id)), zap.String("artifact", a.Name), zap.Error(err))
+		}
+	}
+}
+
+// pruneArtifacts removes artifacts which aren't kept by the retention
+func (d *Djinn) pruneArtifacts() {
+	if d.artifacts == nil {
+		return
+	}
+
+	removed, err := artifact.Prune(d.artifacts, d.ArtifactRetention, time.Now())
+	if err != nil {
+		d.log.Error("could not prune artifacts", zap.String("name", d.config.Name), zap.Error(err))
+		return
+	}
+	d.log.Info("pruned artifacts", zap.String("name", d.config.Name), zap.Int("removed", removed))
+}
@@ -0,0 +1,130 @@
+package djinn
+
+import (
+	"github.com/mewa/djinn/djinn/job"
+	"go.uber.org/zap"
+	"time"
+)
+
+type CompleteRequest struct {
+	// non-empty if the execution failed
+	Error string `json:"error"`
+
+	Output string `json:"output"`
+}
+
+// acceptJob leaves the job running until its execution is completed
+// through a callback or its deadline passes
+func (d *Djinn) acceptJob(j job.Job, res *job.Result) {
+	j.State.State = job.Running
+	j.Pending = &job.Pending{
+		Token:    res.Token,
+		Deadline: res.Start.Add(d.CompletionTimeout),
+		Result:   *res,
+	}
+	req := &JobPutRequest{
+		Job: j,
+	}
+
+	_, err := d.Put(req)
+	if err != nil {
+		d.log.Error("error updating job state", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
+
+		// the execution can't be completed without its token
+		res.Outcome = job.OutcomeFailure
+		res.Error = err.Error()
+		d.completeJob(j, res, 0)
+		return
+	}
+
+	err = d.storage.SaveJobState(j.ID, j.State)
+	if err != nil {
+		d.log.Error("error saving job state", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
+	}
+}
+
+// Complete finishes the accepted execution identified by token. It can be
+// called on any node.
+func (d *Djinn) Complete(token string, req *CompleteRequest) error {
+	d.mu.Lock()
+	var pending *job.Job
+	for _, j := range d.jobs {
+		if j.Pending != nil && j.Pending.Token == token {
+			pending = j
+			break
+		}
+	}
+	if pending == nil {
+		d.mu.Unlock()
+		return ErrUnknownExecution
+	}
+	if d.progress[pending.ID] {
+		d.mu.Unlock()
+		return ErrExecutionCompleting
+	}
+	d.progress[pending.ID] = true
+	j := *pending
+	rev := d.revisions[j.ID]
+	d.mu.Unlock()
+
+	defer d.done(j.ID)
+
+	d.log.Info("completing execution", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.String("error", req.Error))
+
+	res := j.Pending.Result
+	res.Outcome = job.OutcomeSuccess
+	res.Error = req.Error
+	res.Output = req.Output
+	if req.Error != "" {
+		res.Outcome = job.OutcomeFailure
+	}
+	err := d.completeJob(j, finish(&res), rev)
+	if err == ErrJobModified {
+		// completed elsewhere in the meantime
+		return ErrUnknownExecution
+	}
+	return err
+}
+
+// checkDeadlines fails accepted executions which weren't completed in
+// time
+func (d *Djinn) checkDeadlines() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.isLeader() {
+		return
+	}
+
+	now := time.Now()
+	for _, pending := range d.jobs {
+		if pending.Pending == nil || d.progress[pending.ID] || now.Before(pending.Pending.Deadline) {
+			continue
+		}
+		d.progress[pending.ID] = true
+
+		go func(j job.Job, rev int64) {
+			defer d.done(j.ID)
+
+			d.log.Info("execution deadline exceeded", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Time("deadline", j.Pending.Deadline))
+
+			res := j.Pending.Result
+			res.Outcome = job.OutcomeFailure
+			res.Error = ErrDeadlineExceeded.Error()
+			d.completeJob(j, finish(&res), rev)
+		}(*pending, d.revisions[pending.ID])
+	}
+}
+
+func (d *Djinn) done(id job.ID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.progress[id] = false
+}
+
+// finish fills in the timing of a completed execution
+func finish(res *job.Result) *job.Result {
+	res.End = time.Now()
+	res.Duration = res.End.Sub(res.Start)
+	return res
+}
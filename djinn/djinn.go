@@ -1,27 +1,55 @@
 package djinn
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"github.com/coreos/etcd/compactor"
 	"github.com/coreos/etcd/embed"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
 	"github.com/coreos/etcd/mvcc"
 	"github.com/coreos/etcd/mvcc/mvccpb"
 	"github.com/coreos/etcd/pkg/idutil"
 	"github.com/coreos/etcd/pkg/wait"
+	"github.com/mewa/djinn/artifact"
 	"github.com/mewa/djinn/cron"
 	"github.com/mewa/djinn/djinn/job"
 	"github.com/mewa/djinn/executor"
 	"github.com/mewa/djinn/storage"
+	etcdstorage "github.com/mewa/djinn/storage/etcd"
+	"github.com/mewa/djinn/utils"
 	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 	"go.uber.org/zap"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
 
+// keys of the etcd keyspace which don't hold jobs start with the reserved
+// prefix
+const reservedPrefix = "\x00djinn/"
+
+// number of latest etcd revisions kept by compaction, which the leader
+// runs periodically
+const compactionRetention = "1000"
+
 type Djinn struct {
+	// time accepted executions have to be completed in through a
+	// callback, before they're failed
+	CompletionTimeout time.Duration
+
+	// decides which artifacts of executions are kept, see UseArtifacts
+	ArtifactRetention artifact.Retention
+
+	// decides which states of executions are kept by storages
+	// implementing storage.Pruner, in a dry run they're only counted
+	HistoryRetention storage.RetentionPolicy
+	PruneDryRun      bool
+
 	etcd   *embed.Etcd
 	config *embed.Config
 
@@ -33,15 +61,28 @@ type Djinn struct {
 	apiServer string
 	bindAll   bool
 
-	cron     cron.Cron
-	storage  storage.Storage
-	executor executor.Executor
+	cron      cron.Cron
+	storage   storage.Storage
+	executor  executor.ContextExecutor
+	artifacts artifact.Store
 
-	server *http.Server
+	server   *http.Server
+	handlers map[string]http.Handler
 
 	jobs     map[job.ID]*job.Job
 	progress map[job.ID]bool
 
+	// etcd revisions jobs were last modified at
+	revisions map[job.ID]int64
+
+	pools map[string]*pool
+
+	// cancel functions of running executions
+	executions map[job.ID]context.CancelFunc
+
+	// parents of running executions triggered by other ones
+	parents map[job.ID]*job.Parent
+
 	wait  wait.Wait
 	idGen *idutil.Generator
 
@@ -64,6 +105,11 @@ func New(name, server, clientPort, apiServer string, bindAll bool, discovery str
 	conf.Name = name
 	conf.Dir = "/tmp/djinn/" + name
 
+	// history of deleted and overwritten keys would grow without bound,
+	// jobs are loaded by a range instead of replaying it
+	conf.AutoCompactionMode = compactor.ModeRevision
+	conf.AutoCompactionRetention = compactionRetention
+
 	// we don't want to persist data on disk
 	err := os.RemoveAll(conf.Dir)
 
@@ -83,6 +129,11 @@ func New(name, server, clientPort, apiServer string, bindAll bool, discovery str
 	conf.DNSCluster = discovery
 
 	djinn := &Djinn{
+		CompletionTimeout: 24 * time.Hour,
+		ArtifactRetention: artifact.Retention{
+			MaxAge: 30 * 24 * time.Hour,
+		},
+
 		config: conf,
 
 		cluster: "default",
@@ -94,12 +145,20 @@ func New(name, server, clientPort, apiServer string, bindAll bool, discovery str
 		bindAll:   bindAll,
 
 		storage:  storage,
-		executor: executor,
+		executor: wrapExecutor(executor),
 
 		cron: cron.New(),
 
-		jobs:     map[job.ID]*job.Job{},
-		progress: map[job.ID]bool{},
+		handlers: map[string]http.Handler{},
+
+		jobs:      map[job.ID]*job.Job{},
+		progress:  map[job.ID]bool{},
+		revisions: map[job.ID]int64{},
+
+		pools: map[string]*pool{},
+
+		executions: map[job.ID]context.CancelFunc{},
+		parents:    map[job.ID]*job.Parent{},
 
 		wait: wait.New(),
 
@@ -136,6 +195,10 @@ func (d *Djinn) Start() error {
 	d.idGen = idutil.NewGenerator(uint16(e.Server.ID()), time.Now())
 	d.etcd = e
 
+	if b, ok := d.storage.(storage.Binder); ok {
+		b.Bind(etcdstorage.NewKV(e.Server), reservedPrefix+"storage/")
+	}
+
 	err = d.initMetrics()
 	if err != nil {
 		d.log.Error("could not initialise metrics", zap.String("name", d.config.Name), zap.Error(err))
@@ -170,11 +233,19 @@ func (d *Djinn) run() {
 		var ws mvcc.WatchStream = w.NewWatchStream()
 		ch := ws.Chan()
 
-		// watch all changes starting from revision 1
-		id := ws.Watch([]byte{0x0}, []byte{0xff}, 1)
-		if id == -1 {
-			panic("could not watch changes")
-		}
+		// watch changes following the loaded jobs
+		id := d.watch(ws, -1)
+
+		// there is no notification of leadership changes, so we
+		// need to poll for them
+		leadership := time.NewTicker(time.Duration(d.config.TickMs) * time.Millisecond)
+		defer leadership.Stop()
+
+		deadlines := time.NewTicker(time.Second)
+		defer deadlines.Stop()
+
+		prune := time.NewTicker(pruneInterval)
+		defer prune.Stop()
 
 		d.Started <- struct{}{}
 	Loop:
@@ -183,9 +254,23 @@ func (d *Djinn) run() {
 			case <-d.stop:
 				break Loop
 			case r := <-ch:
+				if r.CompactRevision != 0 {
+					// we fell behind compaction, the changes
+					// we missed are gone
+					d.log.Info("watch compacted, reloading jobs", zap.String("name", d.config.Name), zap.Int64("revision", r.CompactRevision))
+					id = d.watch(ws, id)
+					continue
+				}
 				for _, event := range r.Events {
 					d.applyEvent(event)
 				}
+			case <-leadership.C:
+				d.checkLeadership()
+			case <-deadlines.C:
+				d.checkDeadlines()
+			case <-prune.C:
+				go d.pruneArtifacts()
+				go d.pruneHistory()
 			}
 		}
 	}
@@ -196,7 +281,70 @@ func (d *Djinn) run() {
 	d.Done <- struct{}{}
 }
 
+// watch loads the current jobs and watches changes following them,
+// replacing the watch with the given id
+func (d *Djinn) watch(ws mvcc.WatchStream, id mvcc.WatchID) mvcc.WatchID {
+	if id != -1 {
+		ws.Cancel(id)
+	}
+
+	var rev int64
+	err := utils.Backoff(100*time.Millisecond, time.Minute, func() error {
+		var err error
+		rev, err = d.load()
+		return err
+	})
+	if err != nil {
+		panic("could not load jobs: " + err.Error())
+	}
+
+	id = ws.Watch([]byte{0x0}, []byte{0xff}, rev+1)
+	if id == -1 {
+		panic("could not watch changes")
+	}
+	return id
+}
+
+// load applies jobs saved in etcd, removing the ones which are gone, and
+// returns the revision they were read at
+func (d *Djinn) load() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(10*d.config.ElectionMs))
+	defer cancel()
+
+	resp, err := d.etcd.Server.Range(ctx, &etcdserverpb.RangeRequest{
+		Key:      []byte{0x0},
+		RangeEnd: []byte{0xff},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	saved := map[job.ID]bool{}
+	for _, kv := range resp.Kvs {
+		saved[job.ID(kv.Key)] = true
+		d.applyEvent(mvccpb.Event{Type: mvccpb.PUT, Kv: kv})
+	}
+
+	d.mu.Lock()
+	var gone []job.ID
+	for id := range d.jobs {
+		if !saved[id] {
+			gone = append(gone, id)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, id := range gone {
+		d.applyEvent(mvccpb.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte(id)}})
+	}
+	return resp.Header.Revision, nil
+}
+
 func (d *Djinn) Stop() {
+	d.mu.Lock()
+	d.cancelExecutions()
+	d.mu.Unlock()
+
 	if d.running {
 		d.stop <- struct{}{}
 		<-d.Done
@@ -209,6 +357,10 @@ func (d *Djinn) Stop() {
 }
 
 func (d *Djinn) applyEvent(event mvccpb.Event) {
+	if bytes.HasPrefix(event.Kv.Key, []byte(reservedPrefix)) {
+		return
+	}
+
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
@@ -225,6 +377,7 @@ func (d *Djinn) applyEvent(event mvccpb.Event) {
 			Run: d.runJob,
 		}
 
+		d.revisions[req.Job.ID] = event.Kv.ModRevision
 		d.putJob(&req.Job)
 		d.wait.Trigger(req.Id, req.Job)
 		return
@@ -232,10 +385,15 @@ func (d *Djinn) applyEvent(event mvccpb.Event) {
 	if event.Type == mvccpb.DELETE {
 		jid := job.ID(event.Kv.Key)
 
+		if cancel, running := d.executions[jid]; running {
+			cancel()
+		}
+
 		saved, exists := d.jobs[jid]
 		if exists {
 			d.deleteJob(saved)
 		}
+		delete(d.revisions, jid)
 
 		hash := uint64(jid.Hash())
 		d.wait.Trigger(hash, jid)
@@ -267,101 +425,263 @@ func (d *Djinn) deleteJob(j *job.Job) {
 }
 
 func (d *Djinn) runJob(j *job.Job) {
+	// by the time we reach this point PrevTime holds current execution's time
+	d.startJob(j, j.PrevTime, nil)
+}
+
+// startJob runs the job in the background as its execution at time t. The
+// returned channel receives the error of the execution once it's done.
+func (d *Djinn) startJob(j *job.Job, t time.Time, parent *job.Parent) (<-chan error, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	if !d.isLeader() {
-		return
+		return nil, ErrNotLeader
 	}
 
 	running := d.progress[j.ID]
 	if running {
 		d.log.Info("job in progress, skipping", zap.String("name", d.config.Name), zap.Stringer("job", j))
-		return
+		return nil, ErrJobRunning
 	}
 	d.progress[j.ID] = true
 
+	ctx, cancel := context.WithCancel(context.Background())
+	d.executions[j.ID] = cancel
+	if parent != nil {
+		d.parents[j.ID] = parent
+	}
+
+	done := make(chan error, 1)
 	go func(j job.Job) {
+		var err error
 		defer func() {
 			d.mu.Lock()
 			defer d.mu.Unlock()
 			d.progress[j.ID] = false
+
+			delete(d.executions, j.ID)
+			delete(d.parents, j.ID)
+			cancel()
+
+			done <- err
 		}()
 
-		d.log.Info("running job", zap.String("name", d.config.Name), zap.Stringer("job", &j))
-		// TODO: this doesn't take care of leadership losses while in between states
-		if j.State.State == job.Initial || j.State.State == job.Started {
-			// by the time we reach this point PrevTime holds current execution's time
-			j.State = job.State{job.Starting, j.PrevTime.Unix()}
-			req := &JobPutRequest{
-				Job: j,
-			}
+		err = d.execute(ctx, j, t, parent)
+	}(*j)
 
-			_, err := d.Put(req)
-			if err != nil {
-				d.log.Error("error starting job", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
+	return done, nil
+}
 
-				err = d.storage.SaveJobState(j.ID, job.State{job.Error, j.State.Time})
-				if err != nil {
-					d.log.Error("error saving job state", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
-				}
-				return
-			} else {
-				err = d.storage.SaveJobState(j.ID, req.Job.State)
-				if err != nil {
-					d.log.Error("error saving job state", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
-				}
-			}
+// execute runs a single execution of the job, returning its error
+func (d *Djinn) execute(ctx context.Context, j job.Job, t time.Time, parent *job.Parent) error {
+	d.log.Info("running job", zap.String("name", d.config.Name), zap.Stringer("job", &j))
 
-			// TODO: handle job execution failures
-			err = d.executeJob(&j)
+	// TODO: this doesn't take care of leadership losses while in between states
+	if j.State.State != job.Initial && j.State.State != job.Started {
+		return ErrNotRunnable
+	}
 
-			if err != nil {
-				j.State.State = job.Error
+	release, err := d.acquirePool(ctx, &j)
+	if err != nil {
+		d.log.Info("job not run", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.String("pool", j.Pool), zap.Error(err))
 
-				err = d.storage.SaveJobState(j.ID, j.State)
-				if err != nil {
-					d.log.Error("error saving job state", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
-				}
+		if err == ErrPoolFull {
+			mctx, _ := tag.New(context.Background(), tag.Insert(KeyStatus, "skipped"), tag.Insert(KeyType, j.Kind))
+			stats.Record(mctx, MJobExecutions.M(1))
+		}
+		return err
+	}
+	defer release()
 
-				return
-			} else {
-				j.State.State = job.Started
-				req = &JobPutRequest{
-					Job: j,
-				}
+	j.State = job.State{job.Starting, t.Unix()}
+	req := &JobPutRequest{
+		Job: j,
+	}
 
-				_, err = d.Put(req)
-				if err != nil {
-					d.log.Error("error updating job state", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
-				}
-			}
+	_, putErr := d.Put(req)
+	if putErr != nil {
+		d.log.Error("error starting job", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(putErr))
 
-			err = d.storage.SaveJobState(j.ID, j.State)
-			if err != nil {
-				d.log.Error("error saving job state", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
-			}
+		err = d.storage.SaveJobState(j.ID, job.State{job.Error, j.State.Time})
+		if err != nil {
+			d.log.Error("error saving job state", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
+		}
+		return putErr
+	} else {
+		err = d.storage.SaveJobState(j.ID, req.Job.State)
+		if err != nil {
+			d.log.Error("error saving job state", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
+		}
+	}
 
-			if j.Schedule().Next(time.Now()).IsZero() {
-				rmReq := &JobDeleteRequest{
-					JobId: j.ID,
-				}
+	// TODO: handle job execution failures
+	res, execErr := d.executeJob(ctx, &j, parent)
 
-				err = d.Delete(rmReq)
-				if err != nil {
-					d.log.Error("error deleting job", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
-				}
-			}
+	if execErr != nil {
+		d.completeJob(j, res, 0)
+		return execErr
+	}
+
+	if res.Outcome == job.OutcomeAccepted {
+		d.acceptJob(j, res)
+		return nil
+	}
+	d.completeJob(j, res, 0)
+	return nil
+}
+
+// completeJob saves the final state and result of an execution, removing
+// jobs which won't run again. Unless rev is zero, the execution is only
+// completed if the job wasn't modified since revision rev, so that it's
+// completed once. Jobs deleted in the meantime aren't put back.
+func (d *Djinn) completeJob(j job.Job, res *job.Result, rev int64) error {
+	// failures are only recorded in the storage, the job has to stay
+	// runnable
+	j.State.State = job.Started
+	j.Pending = nil
+	req := &JobPutRequest{
+		Job: j,
+	}
+
+	var putErr error
+	if d.exists(j.ID) {
+		_, putErr = d.putIf(req, rev)
+	}
+	if putErr == ErrJobModified {
+		d.log.Info("execution already completed", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)))
+		return putErr
+	}
+	if putErr != nil {
+		d.log.Error("error updating job state", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(putErr))
+	}
+
+	j.State.State = res.Outcome.State()
+	err := d.storage.SaveJobState(j.ID, j.State)
+	if err != nil {
+		d.log.Error("error saving job state", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
+	}
+	d.saveJobResult(j.ID, res)
+
+	if res.Outcome == job.OutcomeSuccess && j.Schedule().Next(time.Now()).IsZero() {
+		rmReq := &JobDeleteRequest{
+			JobId: j.ID,
 		}
-	}(*j)
+
+		err = d.Delete(rmReq)
+		if err != nil {
+			d.log.Error("error deleting job", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.Error(err))
+		}
+	}
+	return putErr
 }
 
-func (d *Djinn) executeJob(j *job.Job) error {
-	stats.Record(context.Background(), MJobExecutions.M(1))
+// wrapExecutor protects the leader from panicking executions and
+// records their outcomes
+func wrapExecutor(ex executor.Executor) executor.ContextExecutor {
+	return executor.Chain(executor.WithContext(ex), recordExecutions, executor.Recover())
+}
 
-	err := d.executor.Execute(j, job.Remover(d))
+// executeJob runs the job, describing the execution with a result
+func (d *Djinn) executeJob(ctx context.Context, j *job.Job, parent *job.Parent) (*job.Result, error) {
+	start := time.Now()
+	res, err := d.executor.ExecuteContext(ctx, j, job.Remover(d))
+	end := time.Now()
 
-	return err
+	if res == nil {
+		res = &job.Result{}
+	}
+	if res.Attempt == 0 {
+		res.Attempt = 1
+	}
+
+	res.Time = j.State.Time
+	res.Parent = parent
+	res.Start = start
+	res.End = end
+	res.Duration = end.Sub(start)
+
+	d.storeArtifacts(j.ID, res)
+
+	if err == nil && res.Outcome == job.OutcomeAccepted && res.Token == "" {
+		// there would be no way to complete it
+		res.Outcome = ""
+		err = ErrMissingToken
+	}
+
+	if err == nil {
+		if res.Outcome != job.OutcomeAccepted {
+			res.Outcome = job.OutcomeSuccess
+		}
+	} else {
+		if ctx.Err() != nil {
+			// the job has been deleted or we're no longer
+			// allowed to run it
+			res.Outcome = job.OutcomeCancelled
+		} else if res.Outcome == "" || res.Outcome == job.OutcomeSuccess {
+			res.Outcome = job.OutcomeFailure
+		}
+		res.Error = err.Error()
+	}
+
+	return res, err
+}
+
+// saveJobResult persists the result if the storage supports it
+func (d *Djinn) saveJobResult(id job.ID, res *job.Result) {
+	rs, ok := d.storage.(storage.ResultStorage)
+	if !ok {
+		return
+	}
+
+	err := rs.SaveJobResult(id, *res)
+	if err != nil {
+		d.log.Error("error saving job result", zap.String("name", d.config.Name), zap.String("job_id", string(id)), zap.Error(err))
+	}
+}
+
+// validate checks whether the job can be run by the configured executor
+func (d *Djinn) validate(j *job.Job) error {
+	if strings.HasPrefix(string(j.ID), reservedPrefix) {
+		return ErrReservedID
+	}
+
+	if err := d.validatePool(j); err != nil {
+		return err
+	}
+
+	if v, ok := d.executor.(executor.Validator); ok {
+		return v.Validate(j)
+	}
+	return nil
+}
+
+// cancelExecutions cancels all running executions, d.mu must be held
+func (d *Djinn) cancelExecutions() {
+	for _, cancel := range d.executions {
+		cancel()
+	}
+}
+
+// checkLeadership cancels running executions once the node is no longer
+// the leader
+func (d *Djinn) checkLeadership() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.executions) > 0 && !d.isLeader() {
+		d.log.Info("lost leadership, cancelling executions", zap.String("name", d.config.Name), zap.Int("executions", len(d.executions)))
+		d.cancelExecutions()
+	}
+}
+
+// exists tells whether the job wasn't deleted
+func (d *Djinn) exists(id job.ID) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, ok := d.jobs[id]
+	return ok
 }
 
 func (d *Djinn) isLeader() bool {
@@ -380,3 +700,48 @@ func (d *Djinn) Remove(j *job.Job) error {
 	}
 	return err
 }
+
+// Trigger runs the job right away regardless of its schedule, the same
+// way a manual run does. The returned channel receives the error of the
+// execution once it's done. Jobs can only be triggered on the leader and
+// never by an execution they triggered themselves.
+func (d *Djinn) Trigger(id job.ID, parent *job.Parent) (<-chan error, error) {
+	d.mu.Lock()
+	saved, exists := d.jobs[id]
+	var j job.Job
+	if exists {
+		j = *saved
+	}
+	parent = d.chain(parent)
+	d.mu.Unlock()
+
+	if !exists {
+		return nil, ErrUnknownJob
+	}
+	if j.State.State != job.Initial && j.State.State != job.Started {
+		return nil, ErrNotRunnable
+	}
+	if parent != nil {
+		for _, ancestor := range append(parent.Chain, parent.ID) {
+			if ancestor == id {
+				return nil, ErrTriggerCycle
+			}
+		}
+	}
+	return d.startJob(&j, time.Now(), parent)
+}
+
+// chain returns a copy of the parent extended with the jobs which
+// triggered its execution, d.mu must be held
+func (d *Djinn) chain(parent *job.Parent) *job.Parent {
+	if parent == nil {
+		return nil
+	}
+
+	p := *parent
+	p.Chain = nil
+	if grandparent, ok := d.parents[p.ID]; ok {
+		p.Chain = append(append(p.Chain, grandparent.Chain...), grandparent.ID)
+	}
+	return &p
+}
@@ -292,3 +292,92 @@ func Test_ExecuteJob_Cron_1(t *testing.T) {
 		t.Fatalf("invalid job states: expected='%v', actual='%v'", expected, actual)
 	}
 }
+
+var errExecution = fmt.Errorf("execution failed")
+
+type failingExecutor struct{}
+
+func (ex failingExecutor) Execute(job *job.Job, rm job.Remover) error {
+	return errExecution
+}
+
+func Test_ExecuteJob_FailedRunnable(t *testing.T) {
+	store := newStorage()
+	d, _ := New("execute_failed_test", "http://localhost:2380", "2379", "localhost:4444", true, "one.etcd.test.thedjinn.io", store, failingExecutor{})
+
+	err := d.Start()
+	defer d.Stop()
+
+	if err != nil {
+		t.Fatalf("error starting djinn: %s", err)
+	}
+
+	select {
+	case <-d.Started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out")
+	}
+
+	req := &JobPutRequest{
+		Job: job.Job{
+			ID: "test-failed-job",
+			Descriptor: schedule.JSONSchedule{
+				ScheduleType: 1,
+				ScheduleData: "0 0 0 1 1 *",
+			},
+		},
+	}
+	if _, err := d.Put(req); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		// the failed execution leaves the job runnable
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			d.mu.Lock()
+			state := d.jobs[req.Job.ID].State.State
+			d.mu.Unlock()
+
+			if state == job.Initial || state == job.Started {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("job not runnable after execution %d: state='%v'", i, state)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		done, err := d.Trigger(req.Job.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := <-done; err != errExecution {
+			t.Fatalf("invalid error of execution %d: expected='%v', actual='%v'", i, errExecution, err)
+		}
+	}
+}
+
+func Test_Trigger_Cycle(t *testing.T) {
+	d := &Djinn{
+		jobs: map[job.ID]*job.Job{
+			"a": {ID: "a"},
+		},
+		// a triggered b, which triggered the running execution of c
+		parents: map[job.ID]*job.Parent{
+			"b": {ID: "a", Time: 1},
+			"c": {ID: "b", Time: 1, Chain: []job.ID{"a"}},
+		},
+		mu: new(sync.Mutex),
+	}
+
+	_, err := d.Trigger("a", &job.Parent{ID: "c", Time: 1})
+	if err != ErrTriggerCycle {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrTriggerCycle, err)
+	}
+
+	_, err = d.Trigger("a", &job.Parent{ID: "b", Time: 1})
+	if err != ErrTriggerCycle {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrTriggerCycle, err)
+	}
+}
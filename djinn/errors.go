@@ -7,4 +7,21 @@ import (
 var (
 	ErrUnknownScheduleType = errors.New("unknown schedule type")
 	ErrCannotResolveService = errors.New("could not resolve service")
+	ErrMissingToken = errors.New("accepted execution is missing a token")
+	ErrUnknownExecution = errors.New("unknown execution")
+	ErrExecutionCompleting = errors.New("execution is already being completed")
+	ErrDeadlineExceeded = errors.New("execution was not completed by its deadline")
+	ErrPoolFull = errors.New("pool is full")
+	ErrUnknownPool = errors.New("unknown pool")
+	ErrUnknownPoolPolicy = errors.New("unknown pool policy")
+	ErrUnknownJob = errors.New("unknown job")
+	ErrJobRunning = errors.New("job is already running")
+	ErrNotLeader = errors.New("node is not the leader")
+	ErrNotRunnable = errors.New("job can't be run in its current state")
+	ErrTriggerCycle = errors.New("job triggered by its own execution")
+	ErrReservedID = errors.New("job id uses a reserved prefix")
+	ErrNoArtifactStore = errors.New("no artifact store")
+	ErrHistoryUnsupported = errors.New("storage doesn't support reading history")
+	ErrJobModified = errors.New("job was modified concurrently")
+	ErrInvalidLimit = errors.New("limit has to be positive")
 )
@@ -2,6 +2,8 @@ package job
 
 import (
 	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/mewa/djinn/schedule"
 	"time"
@@ -18,6 +20,19 @@ const (
 	Starting
 	Started
 	Error
+	Cancelled
+	MemoryExceeded
+	CPUExceeded
+	Running
+)
+
+// PoolPolicy decides what happens to executions of a job when its pool
+// is full.
+type PoolPolicy string
+
+const (
+	PoolQueue PoolPolicy = "queue"
+	PoolSkip  PoolPolicy = "skip"
 )
 
 type State struct {
@@ -48,6 +63,21 @@ type Job struct {
 
 	Descriptor schedule.JSONSchedule `json:"schedule"`
 
+	// selects the executor which runs the job
+	Kind string `json:"kind,omitempty"`
+
+	// executor specific data, e.g. the request issued by an HTTP
+	// executor
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	// concurrency pool limiting executions of the job, and what to do
+	// when it's full, queueing executions by default
+	Pool       string     `json:"pool,omitempty"`
+	PoolPolicy PoolPolicy `json:"pool_policy,omitempty"`
+
+	// set while an accepted execution waits for its callback
+	Pending *Pending `json:"pending,omitempty"`
+
 	NextTime time.Time `json:"next"`
 	PrevTime time.Time `json:"prev"`
 
@@ -67,6 +97,11 @@ func (job *Job) Update(with *Job) {
 	job.State = with.State
 	job.NextTime = with.NextTime
 	job.PrevTime = with.PrevTime
+	job.Kind = with.Kind
+	job.Payload = with.Payload
+	job.Pending = with.Pending
+	job.Pool = with.Pool
+	job.PoolPolicy = with.PoolPolicy
 
 	if job.Descriptor != with.Descriptor {
 		job.Descriptor = with.Descriptor
@@ -112,10 +147,36 @@ func (s state) String() string {
 		return "started"
 	case Error:
 		return "error"
+	case Cancelled:
+		return "cancelled"
+	case MemoryExceeded:
+		return "memory_exceeded"
+	case CPUExceeded:
+		return "cpu_exceeded"
+	case Running:
+		return "running"
 	}
 	return "unknown"
 }
 
+// Failed reports whether the state ends a failed execution.
+func (s state) Failed() bool {
+	return s == Error || s == MemoryExceeded || s == CPUExceeded
+}
+
+var ErrUnknownState = errors.New("unknown job state")
+
+// ParseState returns the state named name, as returned by its String
+// method.
+func ParseState(name string) (state, error) {
+	for s := Initial; s <= Running; s++ {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return 0, ErrUnknownState
+}
+
 func (job *Job) String() string {
 	return fmt.Sprintf("{id=%s, state=%s, descriptor=%v, next=%s, prev=%s}", job.ID, job.State, job.Descriptor, job.NextTime, job.PrevTime)
 }
@@ -0,0 +1,128 @@
+package job
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess   Outcome = "success"
+	OutcomeFailure   Outcome = "failure"
+	OutcomeCancelled Outcome = "cancelled"
+
+	// the execution continues elsewhere and is completed through a
+	// callback carrying the result's token
+	OutcomeAccepted Outcome = "accepted"
+
+	// failures caused by resource limits
+	OutcomeMemoryExceeded Outcome = "memory_exceeded"
+	OutcomeCPUExceeded    Outcome = "cpu_exceeded"
+)
+
+// State returns the job state an execution with this outcome ends in.
+func (o Outcome) State() state {
+	switch o {
+	case OutcomeSuccess:
+		return Started
+	case OutcomeCancelled:
+		return Cancelled
+	case OutcomeAccepted:
+		return Running
+	case OutcomeMemoryExceeded:
+		return MemoryExceeded
+	case OutcomeCPUExceeded:
+		return CPUExceeded
+	}
+	return Error
+}
+
+// Result describes a single execution of a job. Executors fill in the
+// details they know about, timing and outcome are filled in by djinn.
+type Result struct {
+	// scheduled time of the execution, same as the Time of the
+	// states it produced
+	Time int64 `json:"time"`
+
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+
+	// executors may set a specific failure outcome, otherwise it's
+	// derived from the returned error
+	Outcome Outcome `json:"outcome"`
+	Error   string  `json:"error,omitempty"`
+
+	// process exit code or response status code, depending on the
+	// executor
+	ExitCode   int `json:"exit_code,omitempty"`
+	StatusCode int `json:"status_code,omitempty"`
+
+	// rows affected by SQL statements
+	RowsAffected int64 `json:"rows_affected,omitempty"`
+
+	// truncated output of the execution
+	Output string `json:"output,omitempty"`
+
+	// blobs attached to the execution, djinn stores them and records
+	// references to them
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+
+	// name of the failover backend which ran the execution
+	Backend string `json:"backend,omitempty"`
+
+	// number of attempts it took to finish the execution
+	Attempt int `json:"attempt"`
+
+	// identifies accepted executions in completion callbacks
+	Token string `json:"token,omitempty"`
+
+	// set for executions triggered by another one
+	Parent *Parent `json:"parent,omitempty"`
+}
+
+// Parent identifies the execution which triggered another one.
+type Parent struct {
+	ID   ID    `json:"id"`
+	Time int64 `json:"time"`
+
+	// jobs which triggered the parent's execution, the first one
+	// started the chain
+	Chain []ID `json:"chain,omitempty"`
+}
+
+// Artifact is a named blob attached to an execution.
+type Artifact struct {
+	Name string `json:"name"`
+
+	// key of the blob in the artifact store, empty if it couldn't be
+	// stored
+	Key  string `json:"key,omitempty"`
+	Size int64  `json:"size"`
+
+	// contents attached by the executor, closed once they're stored if
+	// they implement io.Closer
+	Blob io.Reader `json:"-"`
+}
+
+// Attach attaches a blob to the execution.
+func (r *Result) Attach(name string, blob io.Reader) {
+	r.Artifacts = append(r.Artifacts, Artifact{Name: name, Blob: blob})
+}
+
+// Pending describes an accepted execution waiting for its callback.
+type Pending struct {
+	Token string `json:"token"`
+
+	// the execution fails unless its callback arrives by then
+	Deadline time.Time `json:"deadline"`
+
+	// result of the execution so far
+	Result Result `json:"result"`
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("{%s@%s, duration=%s, attempt=%d}", r.Outcome, time.Unix(r.Time, 0), r.Duration, r.Attempt)
+}
@@ -1,6 +1,9 @@
 package djinn
 
 import (
+	"context"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
@@ -10,12 +13,16 @@ var (
 	MHttpRequests       = stats.Int64("dcron/http_requests", "Number of HTTP API requests", stats.UnitDimensionless)
 	MHttpRequestLatency = stats.Float64("dcron/http_request_latency", "HTTP API request latency", "ms")
 	MJobExecutions      = stats.Int64("dcron/job_executions", "Executions of jobs in distributed cron", stats.UnitDimensionless)
+	MPoolQueueDepth     = stats.Int64("dcron/pool_queue_depth", "Executions waiting for a slot in a concurrency pool", stats.UnitDimensionless)
+	MHistoryPruned      = stats.Int64("dcron/history_pruned", "States pruned from execution history", stats.UnitDimensionless)
 )
 
 var (
 	KeyStatus, _ = tag.NewKey("status")
 	KeyMethod, _ = tag.NewKey("method")
 	KeyType, _   = tag.NewKey("type")
+	KeyPool, _   = tag.NewKey("pool")
+	KeyDryRun, _ = tag.NewKey("dry_run")
 )
 
 var (
@@ -40,11 +47,45 @@ var (
 		TagKeys:     []tag.Key{KeyStatus, KeyMethod, KeyType},
 		Aggregation: view.Count(),
 	}
+	PoolQueueDepthView = &view.View{
+		Name:        "pool_queue_depth",
+		Measure:     MPoolQueueDepth,
+		Description: "The number of executions waiting for a slot in a pool",
+		TagKeys:     []tag.Key{KeyPool},
+		Aggregation: view.LastValue(),
+	}
+	HistoryPrunedView = &view.View{
+		Name:        "history_pruned",
+		Measure:     MHistoryPruned,
+		Description: "The number of states pruned from execution history",
+		TagKeys:     []tag.Key{KeyDryRun},
+		Aggregation: view.Sum(),
+	}
 )
 
 func (d *Djinn) initMetrics() error {
 	view.Register(HttpRequestLatencyView)
 	view.Register(HttpRequestCountView)
 	view.Register(JobExecutionsView)
+	view.Register(PoolQueueDepthView)
+	view.Register(HistoryPrunedView)
 	return nil
 }
+
+// recordExecutions records every execution tagged with its outcome and
+// the kind of the executed job
+func recordExecutions(next executor.ContextExecutor) executor.ContextExecutor {
+	return executor.Wrap(next, func(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+		res, err := next.ExecuteContext(ctx, j, rm)
+
+		status := "success"
+		if err != nil {
+			status = "failure"
+		}
+
+		mctx, _ := tag.New(context.Background(), tag.Insert(KeyStatus, status), tag.Insert(KeyType, j.Kind))
+		stats.Record(mctx, MJobExecutions.M(1))
+
+		return res, err
+	})
+}
@@ -0,0 +1,147 @@
+package djinn
+
+import (
+	"context"
+	"github.com/mewa/djinn/djinn/job"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// pool limits the number of executions of jobs naming it which run at the
+// same time. Jobs only run on the leader, so limiting them locally limits
+// them cluster-wide.
+type pool struct {
+	name  string
+	limit int
+
+	running int
+
+	// executions waiting for a free slot, in order of arrival
+	queue []chan struct{}
+
+	mu *sync.Mutex
+}
+
+func newPool(name string, limit int) *pool {
+	return &pool{
+		name:  name,
+		limit: limit,
+		mu:    new(sync.Mutex),
+	}
+}
+
+// acquire takes a slot in the pool. Unless the policy is to skip
+// executions which can't run right away, it waits for one until ctx is
+// done.
+func (p *pool) acquire(ctx context.Context, policy job.PoolPolicy) error {
+	p.mu.Lock()
+	if p.running < p.limit && len(p.queue) == 0 {
+		p.running++
+		p.mu.Unlock()
+		return nil
+	}
+
+	if policy == job.PoolSkip {
+		p.mu.Unlock()
+		return ErrPoolFull
+	}
+
+	ready := make(chan struct{})
+	p.queue = append(p.queue, ready)
+	p.record()
+	p.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		for i, waiting := range p.queue {
+			if waiting == ready {
+				p.queue = append(p.queue[:i], p.queue[i+1:]...)
+				p.record()
+				return ctx.Err()
+			}
+		}
+
+		// we were handed a slot in the meantime
+		p.next()
+		return ctx.Err()
+	}
+}
+
+func (p *pool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.next()
+}
+
+// next hands the slot of a finished execution over to the first waiting
+// one, p.mu must be held
+func (p *pool) next() {
+	if len(p.queue) == 0 {
+		p.running--
+		return
+	}
+
+	ready := p.queue[0]
+	p.queue = p.queue[1:]
+	p.record()
+
+	close(ready)
+}
+
+// record records the queue depth, p.mu must be held
+func (p *pool) record() {
+	ctx, _ := tag.New(context.Background(), tag.Insert(KeyPool, p.name))
+	stats.Record(ctx, MPoolQueueDepth.M(int64(len(p.queue))))
+}
+
+// AddPool creates a concurrency pool, which jobs can name to limit the
+// number of their executions running at the same time. All nodes have to
+// define the same pools before being started.
+func (d *Djinn) AddPool(name string, limit int) {
+	d.pools[name] = newPool(name, limit)
+}
+
+// acquirePool takes a slot in the job's pool, returning a function which
+// releases it
+func (d *Djinn) acquirePool(ctx context.Context, j *job.Job) (func(), error) {
+	if j.Pool == "" {
+		return func() {}, nil
+	}
+
+	p, ok := d.pools[j.Pool]
+	if !ok {
+		// the node validating the job knew the pool, skipping
+		// executions because of a misconfigured node would be worse
+		d.log.Error("unknown pool, running job without limits", zap.String("name", d.config.Name), zap.String("job_id", string(j.ID)), zap.String("pool", j.Pool))
+		return func() {}, nil
+	}
+
+	err := p.acquire(ctx, j.PoolPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return p.release, nil
+}
+
+// validatePool checks whether the job names a known pool and policy
+func (d *Djinn) validatePool(j *job.Job) error {
+	if j.Pool != "" {
+		if _, ok := d.pools[j.Pool]; !ok {
+			return ErrUnknownPool
+		}
+	}
+
+	switch j.PoolPolicy {
+	case "", job.PoolQueue, job.PoolSkip:
+		return nil
+	}
+	return ErrUnknownPoolPolicy
+}
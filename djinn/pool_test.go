@@ -0,0 +1,91 @@
+package djinn
+
+import (
+	"context"
+	"github.com/mewa/djinn/djinn/job"
+	"testing"
+	"time"
+)
+
+func Test_Pool_Skip(t *testing.T) {
+	p := newPool("test", 1)
+
+	if err := p.acquire(context.Background(), job.PoolSkip); err != nil {
+		t.Fatal(err)
+	}
+
+	err := p.acquire(context.Background(), job.PoolSkip)
+	if err != ErrPoolFull {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrPoolFull, err)
+	}
+
+	p.release()
+
+	if err := p.acquire(context.Background(), job.PoolSkip); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_Pool_Queue(t *testing.T) {
+	p := newPool("test", 1)
+
+	if err := p.acquire(context.Background(), job.PoolQueue); err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error)
+	for i := 0; i < 2; i++ {
+		go func() {
+			acquired <- p.acquire(context.Background(), job.PoolQueue)
+		}()
+	}
+
+	select {
+	case <-acquired:
+		t.Fatalf("pool limit exceeded")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.mu.Lock()
+	depth := len(p.queue)
+	p.mu.Unlock()
+	if depth != 2 {
+		t.Fatalf("invalid queue depth: expected='2', actual='%d'", depth)
+	}
+
+	// every release lets exactly one queued execution run
+	for i := 0; i < 2; i++ {
+		p.release()
+		if err := <-acquired; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p.mu.Lock()
+	running := p.running
+	p.mu.Unlock()
+	if running != 1 {
+		t.Fatalf("invalid number of running executions: expected='1', actual='%d'", running)
+	}
+}
+
+func Test_Pool_QueueCancel(t *testing.T) {
+	p := newPool("test", 1)
+	p.acquire(context.Background(), job.PoolQueue)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := p.acquire(ctx, job.PoolQueue)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", context.DeadlineExceeded, err)
+	}
+
+	p.release()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running != 0 || len(p.queue) != 0 {
+		t.Fatalf("pool not empty: running='%d', queued='%d'", p.running, len(p.queue))
+	}
+}
@@ -0,0 +1,57 @@
+package djinn
+
+import (
+	"context"
+	"github.com/mewa/djinn/artifact"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/storage"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+// how often artifacts and execution history are pruned
+const pruneInterval = time.Hour
+
+// pruneHistory removes states of executions which aren't kept by
+// HistoryRetention from the storage, together with their artifacts.
+// Shared storages, e.g. kept in etcd, are only pruned by the leader.
+func (d *Djinn) pruneHistory() {
+	p, ok := d.storage.(storage.Pruner)
+	if !ok {
+		return
+	}
+	if shared, ok := d.storage.(storage.SharedStorage); ok && shared.Shared() && !d.isLeader() {
+		return
+	}
+
+	pruned, err := p.Prune(d.HistoryRetention, time.Now(), d.PruneDryRun)
+
+	ctx, _ := tag.New(context.Background(), tag.Insert(KeyDryRun, strconv.FormatBool(d.PruneDryRun)))
+	stats.Record(ctx, MHistoryPruned.M(int64(pruned.States)))
+
+	// executions removed before a failure are still done with
+	if !d.PruneDryRun && d.artifacts != nil && len(pruned.Executions) > 0 {
+		removed := map[storage.Execution]bool{}
+		for _, e := range pruned.Executions {
+			removed[e] = true
+		}
+
+		n, aerr := artifact.RemoveExecutions(d.artifacts, func(id job.ID, t int64) bool {
+			return removed[storage.Execution{Job: id, Time: t}]
+		})
+		if aerr != nil {
+			d.log.Error("could not remove artifacts of pruned executions", zap.String("name", d.config.Name), zap.Int("removed", n), zap.Error(aerr))
+		} else {
+			d.log.Info("removed artifacts of pruned executions", zap.String("name", d.config.Name), zap.Int("removed", n))
+		}
+	}
+
+	if err != nil {
+		d.log.Error("could not prune execution history", zap.String("name", d.config.Name), zap.Int("pruned", pruned.States), zap.Error(err))
+		return
+	}
+	d.log.Info("pruned execution history", zap.String("name", d.config.Name), zap.Int("pruned", pruned.States), zap.Int("executions", len(pruned.Executions)), zap.Bool("dry_run", d.PruneDryRun))
+}
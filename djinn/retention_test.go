@@ -0,0 +1,66 @@
+package djinn
+
+import (
+	"github.com/coreos/etcd/embed"
+	"github.com/mewa/djinn/artifact"
+	"github.com/mewa/djinn/storage"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPruner struct {
+	testStorage
+	pruned storage.Pruned
+}
+
+func (p *testPruner) Prune(policy storage.RetentionPolicy, now time.Time, dryRun bool) (storage.Pruned, error) {
+	return p.pruned, nil
+}
+
+func Test_PruneHistory_Artifacts(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "djinn-artifacts")
+	defer os.RemoveAll(dir)
+
+	store, err := artifact.NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for _, tm := range []int64{100, 200} {
+		key, _ := artifact.Key("test-job", tm, "out.log")
+		store.Put(key, strings.NewReader("output"))
+		keys = append(keys, key)
+	}
+
+	d := &Djinn{
+		storage: &testPruner{
+			testStorage: *newStorage(),
+			pruned: storage.Pruned{
+				States:     2,
+				Executions: []storage.Execution{{Job: "test-job", Time: 100}},
+			},
+		},
+		artifacts:   store,
+		PruneDryRun: true,
+		config:      embed.NewConfig(),
+		log:         zap.NewNop(),
+	}
+
+	d.pruneHistory()
+	if infos, _ := store.List(); len(infos) != 2 {
+		t.Fatalf("dry run removed artifacts: %v", infos)
+	}
+
+	d.PruneDryRun = false
+	d.pruneHistory()
+
+	infos, _ := store.List()
+	if len(infos) != 1 || infos[0].Key != keys[1] {
+		t.Fatalf("invalid artifacts kept: expected='%s', actual='%v'", keys[1], infos)
+	}
+}
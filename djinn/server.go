@@ -5,16 +5,20 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/gorilla/mux"
+	"github.com/mewa/djinn/artifact"
 	"github.com/mewa/djinn/djinn/job"
 	"github.com/mewa/djinn/schedule"
+	"github.com/mewa/djinn/storage"
 	"contrib.go.opencensus.io/exporter/prometheus"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
 	"go.uber.org/zap"
 	"io"
+	"mime"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -25,151 +29,451 @@ type StatusResponse struct {
 	Client  string `json:"client"`
 }
 
+// JobOptions are the parts of a job put on a schedule besides the
+// schedule itself.
+type JobOptions struct {
+	Kind       string          `json:"kind"`
+	Payload    json.RawMessage `json:"payload"`
+	Pool       string          `json:"pool"`
+	PoolPolicy job.PoolPolicy  `json:"pool_policy"`
+}
+
 type PutCronJobRequest struct {
 	Expression string `json:"schedule"`
+	JobOptions
 }
 
 type PutOnceJobRequest struct {
 	Expression string `json:"time"`
+	JobOptions
+}
+
+type PutIntervalJobRequest struct {
+	Interval string `json:"interval"`
+	Anchor   int64  `json:"anchor"`
+	Phase    string `json:"phase"`
+	JobOptions
 }
 
 type PutJobResponse struct {
 	Next int64 `json:"next_execution"`
 }
 
-func (d *Djinn) cronHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, _ := tag.New(context.Background(), tag.Insert(KeyType, "cron"), tag.Insert(KeyMethod, r.Method))
-	start := time.Now()
+type HistoryResponse struct {
+	Records []storage.Record `json:"records"`
 
-	vars := mux.Vars(r)
-	jobId := vars["job"]
+	// passed back to continue the listing, empty once it's exhausted
+	Cursor string `json:"cursor,omitempty"`
+}
 
-	var buf bytes.Buffer
-	io.Copy(&buf, r.Body)
+// number of records listed when a history request doesn't specify it,
+// and the most it can ask for
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// describeSchedule decodes the body of a request putting a job on a
+// schedule
+type describeSchedule func(body []byte) (schedule.JSONSchedule, JobOptions)
 
+func cronSchedule(body []byte) (schedule.JSONSchedule, JobOptions) {
 	var s PutCronJobRequest
-	json.Unmarshal(buf.Bytes(), &s)
+	json.Unmarshal(body, &s)
+
+	return schedule.JSONSchedule{schedule.TypeSpec, s.Expression}, s.JobOptions
+}
+
+func onceSchedule(body []byte) (schedule.JSONSchedule, JobOptions) {
+	var s PutOnceJobRequest
+	json.Unmarshal(body, &s)
+
+	return schedule.JSONSchedule{schedule.TypeOnce, string(body)}, s.JobOptions
+}
+
+func intervalSchedule(body []byte) (schedule.JSONSchedule, JobOptions) {
+	var s PutIntervalJobRequest
+	json.Unmarshal(body, &s)
+
+	data, _ := json.Marshal(&schedule.IntervalSchedule{
+		Interval: s.Interval,
+		Anchor:   s.Anchor,
+		Phase:    s.Phase,
+	})
+	return schedule.JSONSchedule{schedule.TypeInterval, string(data)}, s.JobOptions
+}
 
-	// validate input
-	descr := schedule.JSONSchedule{schedule.TypeSpec, s.Expression}
+// scheduleHandler returns the handler putting jobs on the schedule of the
+// given type, described by the request's body
+func (d *Djinn) scheduleHandler(typ string, describe describeSchedule) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, _ := tag.New(context.Background(), tag.Insert(KeyType, typ), tag.Insert(KeyMethod, r.Method))
+		start := time.Now()
 
-	if _, err := descr.Schedule(); err != nil {
-		ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, "400"))
+		vars := mux.Vars(r)
+		jobId := vars["job"]
+
+		var buf bytes.Buffer
+		io.Copy(&buf, r.Body)
+
+		descr, opts := describe(buf.Bytes())
+
+		// validate input
+		j := job.Job{
+			ID:         job.ID(jobId),
+			Descriptor: descr,
+			Kind:       opts.Kind,
+			Payload:    opts.Payload,
+			Pool:       opts.Pool,
+			PoolPolicy: opts.PoolPolicy,
+		}
+
+		_, err := descr.Schedule()
+		if err == nil {
+			err = d.validate(&j)
+		}
+
+		if err != nil {
+			ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, "400"))
+			stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
+			stats.Record(ctx, MHttpRequests.M(1))
+
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		resp, err := d.Put(&JobPutRequest{
+			Job: j,
+		})
+
+		if err != nil {
+			ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, "503"))
+			stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
+			stats.Record(ctx, MHttpRequests.M(1))
+
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		httpResp, err := json.Marshal(&PutJobResponse{resp.Next})
+
+		if err != nil {
+			ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, "500"))
+			stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
+			stats.Record(ctx, MHttpRequests.M(1))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, "200"))
 		stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
 		stats.Record(ctx, MHttpRequests.M(1))
 
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(err.Error()))
-		return
+		w.Write(httpResp)
 	}
+}
 
-	resp, err := d.Put(&JobPutRequest{
-		Job: job.Job{
-			ID:         job.ID(jobId),
-			Descriptor: descr,
-		},
+func (d *Djinn) statusHandler(w http.ResponseWriter, r *http.Request) {
+	data, _ := json.Marshal(StatusResponse{
+		Running: d.running,
+		Name:    d.name,
+		Server:  d.serverUrl.String(),
+		Client:  d.clientUrl.String(),
 	})
 
-	if err != nil {
-		ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, "503"))
-		stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
-		stats.Record(ctx, MHttpRequests.M(1))
+	var buf bytes.Buffer
+	buf.Write(data)
+	io.Copy(w, &buf)
+}
 
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte(err.Error()))
-		return
+func (d *Djinn) completeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, _ := tag.New(context.Background(), tag.Insert(KeyType, "complete"), tag.Insert(KeyMethod, r.Method))
+	start := time.Now()
+
+	vars := mux.Vars(r)
+	token := vars["token"]
+
+	var req CompleteRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err == nil {
+		err = d.Complete(token, &req)
+	}
+
+	status := http.StatusOK
+	switch err {
+	case nil:
+	case ErrUnknownExecution:
+		status = http.StatusNotFound
+	case ErrExecutionCompleting:
+		status = http.StatusConflict
+	default:
+		if _, ok := err.(*json.SyntaxError); ok {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusServiceUnavailable
+		}
 	}
 
-	httpResp, err := json.Marshal(&PutJobResponse{resp.Next})
+	ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, strconv.Itoa(status)))
+	stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
+	stats.Record(ctx, MHttpRequests.M(1))
 
+	w.WriteHeader(status)
 	if err != nil {
-		ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, "500"))
-		stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
-		stats.Record(ctx, MHttpRequests.M(1))
+		w.Write([]byte(err.Error()))
+	}
+}
 
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+func (d *Djinn) runHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, _ := tag.New(context.Background(), tag.Insert(KeyType, "run"), tag.Insert(KeyMethod, r.Method))
+	start := time.Now()
+
+	vars := mux.Vars(r)
+	jobId := vars["job"]
+
+	_, err := d.Trigger(job.ID(jobId), nil)
+
+	status := http.StatusAccepted
+	switch err {
+	case nil:
+	case ErrUnknownJob:
+		status = http.StatusNotFound
+	case ErrJobRunning, ErrNotRunnable:
+		status = http.StatusConflict
+	default:
+		status = http.StatusServiceUnavailable
 	}
 
-	ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, "200"))
+	ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, strconv.Itoa(status)))
 	stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
 	stats.Record(ctx, MHttpRequests.M(1))
 
-	w.Write(httpResp)
+	w.WriteHeader(status)
+	if err != nil {
+		w.Write([]byte(err.Error()))
+	}
 }
 
-func (d *Djinn) onceHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, _ := tag.New(context.Background(), tag.Insert(KeyType, "once"), tag.Insert(KeyMethod, r.Method))
+func (d *Djinn) stateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, _ := tag.New(context.Background(), tag.Insert(KeyType, "state"), tag.Insert(KeyMethod, r.Method))
 	start := time.Now()
 
 	vars := mux.Vars(r)
 	jobId := vars["job"]
 
-	var buf bytes.Buffer
-	io.Copy(&buf, r.Body)
+	var record *storage.Record
+	reader, err := d.reader()
+	if err == nil {
+		record, err = reader.LatestState(job.ID(jobId))
+	}
 
-	var s PutOnceJobRequest
-	json.Unmarshal(buf.Bytes(), &s)
+	d.writeHistory(ctx, start, w, record, err)
+}
 
-	// validate input
-	descr := schedule.JSONSchedule{schedule.TypeOnce, buf.String()}
+func (d *Djinn) historyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, _ := tag.New(context.Background(), tag.Insert(KeyType, "history"), tag.Insert(KeyMethod, r.Method))
+	start := time.Now()
 
-	if _, err := descr.Schedule(); err != nil {
-		ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, "400"))
-		stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
-		stats.Record(ctx, MHttpRequests.M(1))
+	vars := mux.Vars(r)
+	jobId := vars["job"]
+	query := r.URL.Query()
 
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(err.Error()))
-		return
+	var resp HistoryResponse
+	reader, err := d.reader()
+
+	var from, to time.Time
+	if err == nil {
+		from, err = parseUnix(query.Get("from"))
+	}
+	if err == nil {
+		to, err = parseUnix(query.Get("to"))
 	}
 
-	resp, err := d.Put(&JobPutRequest{
-		Job: job.Job{
-			ID:         job.ID(jobId),
-			Descriptor: descr,
-		},
-	})
+	var limit int
+	if err == nil {
+		limit, err = parseLimit(query.Get("limit"))
+	}
 
-	if err != nil {
-		ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, "503"))
-		stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
-		stats.Record(ctx, MHttpRequests.M(1))
+	if err == nil {
+		resp.Records, resp.Cursor, err = reader.History(job.ID(jobId), from, to, limit, query.Get("cursor"))
+	}
+
+	d.writeHistory(ctx, start, w, &resp, err)
+}
+
+func (d *Djinn) failuresHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, _ := tag.New(context.Background(), tag.Insert(KeyType, "failures"), tag.Insert(KeyMethod, r.Method))
+	start := time.Now()
+
+	var resp HistoryResponse
+	reader, err := d.reader()
+
+	query := r.URL.Query()
+
+	var since time.Time
+	if err == nil {
+		since, err = parseUnix(query.Get("since"))
+	}
+
+	var limit int
+	if err == nil {
+		limit, err = parseLimit(query.Get("limit"))
+	}
+
+	if err == nil {
+		resp.Records, err = reader.ListFailures(since, limit)
+	}
 
-		w.WriteHeader(http.StatusServiceUnavailable)
+	d.writeHistory(ctx, start, w, &resp, err)
+}
+
+// reader returns the storage if it's able to read history
+func (d *Djinn) reader() (storage.Reader, error) {
+	reader, ok := d.storage.(storage.Reader)
+	if !ok {
+		return nil, ErrHistoryUnsupported
+	}
+	return reader, nil
+}
+
+// writeHistory responds with v, or with the status matching err
+func (d *Djinn) writeHistory(ctx context.Context, start time.Time, w http.ResponseWriter, v interface{}, err error) {
+	var data []byte
+	if err == nil {
+		data, err = json.Marshal(v)
+	}
+
+	status := http.StatusOK
+	switch err {
+	case nil:
+	case storage.ErrNotFound:
+		status = http.StatusNotFound
+	case storage.ErrInvalidCursor, job.ErrUnknownState, ErrInvalidLimit:
+		status = http.StatusBadRequest
+	case ErrHistoryUnsupported, storage.ErrReadUnsupported:
+		status = http.StatusNotImplemented
+	default:
+		if _, ok := err.(*strconv.NumError); ok {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, strconv.Itoa(status)))
+	stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
+	stats.Record(ctx, MHttpRequests.M(1))
+
+	if status == http.StatusServiceUnavailable {
+		d.log.Error("error reading history", zap.String("name", d.config.Name), zap.Error(err))
+	}
+
+	if err != nil {
+		w.WriteHeader(status)
 		w.Write([]byte(err.Error()))
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
 
-	httpResp, err := json.Marshal(&PutJobResponse{resp.Next})
+// parseUnix parses a unix timestamp in seconds, an empty one meaning
+// the zero time
+func parseUnix(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
 
+	sec, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
-		ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, "500"))
-		stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
-		stats.Record(ctx, MHttpRequests.M(1))
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0), nil
+}
 
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+// parseLimit parses the number of records to list, capping it at
+// maxHistoryLimit
+func parseLimit(s string) (int, error) {
+	if s == "" {
+		return defaultHistoryLimit, nil
+	}
+
+	limit, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 {
+		return 0, ErrInvalidLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+	return limit, nil
+}
+
+func (d *Djinn) artifactHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, _ := tag.New(context.Background(), tag.Insert(KeyType, "artifact"), tag.Insert(KeyMethod, r.Method))
+	start := time.Now()
+
+	vars := mux.Vars(r)
+	jobId := vars["job"]
+	name := vars["name"]
+
+	var blob io.ReadCloser
+	t, err := strconv.ParseInt(vars["time"], 10, 64)
+
+	var key string
+	if err == nil {
+		key, err = artifact.Key(job.ID(jobId), t, name)
+	}
+	if err == nil {
+		if d.artifacts == nil {
+			err = ErrNoArtifactStore
+		} else {
+			blob, err = d.artifacts.Get(key)
+		}
 	}
 
-	ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, "200"))
+	status := http.StatusOK
+	switch err {
+	case nil:
+	case artifact.ErrNotFound:
+		status = http.StatusNotFound
+	case artifact.ErrInvalidName, artifact.ErrInvalidID:
+		status = http.StatusBadRequest
+	case ErrNoArtifactStore:
+		status = http.StatusNotImplemented
+	default:
+		if _, ok := err.(*strconv.NumError); ok {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	ctx, _ = tag.New(ctx, tag.Insert(KeyStatus, strconv.Itoa(status)))
 	stats.Record(ctx, MHttpRequestLatency.M(float64(time.Now().Sub(start)/time.Millisecond)))
 	stats.Record(ctx, MHttpRequests.M(1))
 
-	w.Write(httpResp)
-}
+	if err != nil {
+		w.WriteHeader(status)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	defer blob.Close()
 
-func (d *Djinn) statusHandler(w http.ResponseWriter, r *http.Request) {
-	data, _ := json.Marshal(StatusResponse{
-		Running: d.running,
-		Name:    d.name,
-		Server:  d.serverUrl.String(),
-		Client:  d.clientUrl.String(),
-	})
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	io.Copy(w, blob)
+}
 
-	var buf bytes.Buffer
-	buf.Write(data)
-	io.Copy(w, &buf)
+// Handle serves h under prefix of the API server, e.g. the worker API of
+// remote.Dispatcher. It has to be called before Start.
+func (d *Djinn) Handle(prefix string, h http.Handler) {
+	d.handlers[prefix] = h
 }
 
 func (d *Djinn) Serve() error {
@@ -186,10 +490,31 @@ func (d *Djinn) Serve() error {
 
 	r.Handle("/metrics", promExport)
 	r.HandleFunc("/status", d.statusHandler)
-	r.HandleFunc("/{job}/cron", d.cronHandler).
+
+	r.HandleFunc("/callbacks/{token}", d.completeHandler).
+		Methods("POST")
+	r.HandleFunc("/failures", d.failuresHandler).
+		Methods("GET")
+
+	// mounted before job routes so that they take precedence
+	for prefix, h := range d.handlers {
+		r.PathPrefix(prefix + "/").Handler(http.StripPrefix(prefix, h))
+	}
+
+	r.HandleFunc("/{job}/cron", d.scheduleHandler("cron", cronSchedule)).
+		Methods("PUT")
+	r.HandleFunc("/{job}/once", d.scheduleHandler("once", onceSchedule)).
 		Methods("PUT")
-	r.HandleFunc("/{job}/once", d.onceHandler).
+	r.HandleFunc("/{job}/interval", d.scheduleHandler("interval", intervalSchedule)).
 		Methods("PUT")
+	r.HandleFunc("/{job}/run", d.runHandler).
+		Methods("POST")
+	r.HandleFunc("/{job}/state", d.stateHandler).
+		Methods("GET")
+	r.HandleFunc("/{job}/history", d.historyHandler).
+		Methods("GET")
+	r.HandleFunc("/{job}/artifacts/{time}/{name}", d.artifactHandler).
+		Methods("GET")
 
 	d.server = &http.Server{
 		Handler: r,
@@ -0,0 +1,190 @@
+package djinn
+
+import (
+	"encoding/json"
+	"github.com/coreos/etcd/embed"
+	"github.com/gorilla/mux"
+	"github.com/mewa/djinn/artifact"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/storage"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testReader struct {
+	testStorage
+}
+
+func (r *testReader) LatestState(id job.ID) (*storage.Record, error) {
+	return nil, storage.ErrNotFound
+}
+
+func (r *testReader) History(id job.ID, from, to time.Time, limit int, cursor string) ([]storage.Record, string, error) {
+	return []storage.Record{{Job: id, State: job.State{State: job.Started, Time: from.Unix()}}}, "next", nil
+}
+
+func (r *testReader) ListFailures(since time.Time, limit int) ([]storage.Record, error) {
+	return nil, nil
+}
+
+func serveHistory(d *Djinn, h http.HandlerFunc, url string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", url, nil)
+	req = mux.SetURLVars(req, map[string]string{"job": "test-job"})
+
+	w := httptest.NewRecorder()
+	h(w, req)
+	return w
+}
+
+func Test_HistoryHandlers(t *testing.T) {
+	d := &Djinn{
+		storage: newStorage(),
+		config:  embed.NewConfig(),
+		log:     zap.NewNop(),
+	}
+
+	w := serveHistory(d, d.stateHandler, "/test-job/state")
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("invalid status: expected='%d', actual='%d'", http.StatusNotImplemented, w.Code)
+	}
+
+	d.storage = &testReader{*newStorage()}
+
+	w = serveHistory(d, d.stateHandler, "/test-job/state")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("invalid status: expected='%d', actual='%d'", http.StatusNotFound, w.Code)
+	}
+
+	w = serveHistory(d, d.historyHandler, "/test-job/history?limit=ten")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid status: expected='%d', actual='%d'", http.StatusBadRequest, w.Code)
+	}
+
+	for _, limit := range []string{"0", "-1"} {
+		w = serveHistory(d, d.historyHandler, "/test-job/history?limit="+limit)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("invalid status for limit '%s': expected='%d', actual='%d'", limit, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	w = serveHistory(d, d.historyHandler, "/test-job/history?from=100&limit=10")
+	if w.Code != http.StatusOK {
+		t.Fatalf("invalid status: expected='%d', actual='%d'", http.StatusOK, w.Code)
+	}
+
+	var resp HistoryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Cursor != "next" || len(resp.Records) != 1 || resp.Records[0].State.Time != 100 {
+		t.Fatalf("invalid response: %+v", resp)
+	}
+
+	w = serveHistory(d, d.failuresHandler, "/failures?since=100")
+	if w.Code != http.StatusOK {
+		t.Fatalf("invalid status: expected='%d', actual='%d'", http.StatusOK, w.Code)
+	}
+}
+
+func Test_ArtifactHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "djinn-artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := artifact.NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Djinn{
+		config: embed.NewConfig(),
+		log:    zap.NewNop(),
+	}
+	d.UseArtifacts(store)
+
+	res := &job.Result{Time: 100}
+	res.Attach("report.csv", strings.NewReader("a,b"))
+	d.storeArtifacts("test-job", res)
+
+	if res.Artifacts[0].Key == "" || res.Artifacts[0].Size != 3 || res.Artifacts[0].Blob != nil {
+		t.Fatalf("artifact not stored: %+v", res.Artifacts[0])
+	}
+
+	serve := func(vars map[string]string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/", nil), vars)
+		w := httptest.NewRecorder()
+		d.artifactHandler(w, req)
+		return w
+	}
+
+	w := serve(map[string]string{"job": "test-job", "time": "100", "name": "report.csv"})
+	if w.Code != http.StatusOK || w.Body.String() != "a,b" {
+		t.Fatalf("invalid response: status='%d', body='%s'", w.Code, w.Body.String())
+	}
+
+	w = serve(map[string]string{"job": "test-job", "time": "200", "name": "report.csv"})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("invalid status: expected='%d', actual='%d'", http.StatusNotFound, w.Code)
+	}
+}
+
+func Test_RunHandler_NotRunnable(t *testing.T) {
+	d := &Djinn{
+		jobs: map[job.ID]*job.Job{
+			"test-job": {ID: "test-job", State: job.State{State: job.Starting}},
+		},
+		storage: newStorage(),
+		config:  embed.NewConfig(),
+		log:     zap.NewNop(),
+		mu:      new(sync.Mutex),
+	}
+
+	req := httptest.NewRequest("POST", "/test-job/run", nil)
+	req = mux.SetURLVars(req, map[string]string{"job": "test-job"})
+
+	w := httptest.NewRecorder()
+	d.runHandler(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("invalid status: expected='%d', actual='%d'", http.StatusConflict, w.Code)
+	}
+}
+
+func Test_ScheduleHandler_Invalid(t *testing.T) {
+	d := &Djinn{
+		storage: newStorage(),
+		config:  embed.NewConfig(),
+		log:     zap.NewNop(),
+		mu:      new(sync.Mutex),
+	}
+
+	cases := []struct {
+		typ      string
+		describe describeSchedule
+		body     string
+	}{
+		{"cron", cronSchedule, `{"schedule": "* * *"}`},
+		{"once", onceSchedule, `{"time": "tomorrow"}`},
+		{"interval", intervalSchedule, `{"interval": "500ms"}`},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("PUT", "/test-job/"+c.typ, strings.NewReader(c.body))
+		req = mux.SetURLVars(req, map[string]string{"job": "test-job"})
+
+		w := httptest.NewRecorder()
+		d.scheduleHandler(c.typ, c.describe)(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("invalid status for %s: expected='%d', actual='%d'", c.typ, http.StatusBadRequest, w.Code)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnknownKind = errors.New("unknown job kind")
+	ErrTimeout     = errors.New("execution timed out")
+	ErrNoBackends  = errors.New("no failover backends")
+)
+
+// PanicError is returned in place of a panic raised by an execution.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("execution panicked: %v", e.Value)
+}
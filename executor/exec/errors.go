@@ -0,0 +1,20 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrMissingCommand = errors.New("missing command")
+)
+
+// ExitError is returned when the command exits with a non-zero exit code.
+type ExitError struct {
+	ExitCode int
+	Stderr   string
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command exited with code %d: %s", e.ExitCode, e.Stderr)
+}
@@ -0,0 +1,159 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"go.uber.org/zap"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// how long output of a command is still read once it exits or is killed
+const waitDelay = 5 * time.Second
+
+// Command describes the process started on every run of a job. It is
+// decoded from the job's payload.
+type Command struct {
+	Args  []string `json:"args"`
+	Env   []string `json:"env"`
+	Dir   string   `json:"dir"`
+	Stdin string   `json:"stdin"`
+}
+
+type Executor struct {
+	// environment every command starts with, job's environment is
+	// appended to it
+	Env []string
+
+	// maximum number of bytes captured from each of stdout and stderr
+	MaxOutput int
+
+	// optional
+	log *zap.Logger
+}
+
+func New(log *zap.Logger) *Executor {
+	return &Executor{
+		Env:       os.Environ(),
+		MaxOutput: 64 * 1024,
+		log:       log,
+	}
+}
+
+// implements executor.Executor
+func (ex *Executor) Execute(j *job.Job, rm job.Remover) error {
+	_, err := ex.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+// implements executor.ContextExecutor, the process is killed when ctx is
+// done
+func (ex *Executor) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	c, err := ParseCommand(j.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	_, res, err := ex.Run(ctx, j, c, nil)
+	return res, err
+}
+
+// Run runs the command of the job with its output captured, start
+// starting the prepared process, cmd.Start if nil. The process runs in
+// its own process group, which is killed as a whole once ctx is done,
+// and output is only read for waitDelay after the process exits, so
+// that processes it left behind can't hold it up. The finished process
+// is returned, unless it couldn't be started. The error is ctx's if it's
+// done, an *ExitError if the command failed.
+func (ex *Executor) Run(ctx context.Context, j *job.Job, c *Command, start func(*exec.Cmd) error) (*exec.Cmd, *job.Result, error) {
+	stdout := &LimitedBuffer{Limit: ex.MaxOutput}
+	stderr := &LimitedBuffer{Limit: ex.MaxOutput}
+
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	cmd.Env = append(append([]string{}, ex.Env...), c.Env...)
+	cmd.Dir = c.Dir
+	cmd.Stdin = bytes.NewBufferString(c.Stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = waitDelay
+	setProcessGroup(cmd)
+
+	if start == nil {
+		start = (*exec.Cmd).Start
+	}
+	if err := start(cmd); err != nil {
+		return nil, nil, err
+	}
+	err := cmd.Wait()
+
+	ex.logger().Info("command finished",
+		zap.String("job_id", string(j.ID)),
+		zap.Strings("args", c.Args),
+		zap.ByteString("stdout", stdout.Bytes()),
+		zap.ByteString("stderr", stderr.Bytes()),
+		zap.Error(err))
+
+	res := &job.Result{
+		Output: stdout.String(),
+	}
+
+	if err != nil && ctx.Err() != nil {
+		return cmd, res, ctx.Err()
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		res.ExitCode = exitErr.ExitCode()
+		return cmd, res, &ExitError{
+			ExitCode: exitErr.ExitCode(),
+			Stderr:   stderr.String(),
+		}
+	}
+	return cmd, res, err
+}
+
+func (ex *Executor) logger() *zap.Logger {
+	if ex.log == nil {
+		return zap.NewNop()
+	}
+	return ex.log
+}
+
+// implements executor.Validator
+func (ex *Executor) Validate(j *job.Job) error {
+	_, err := ParseCommand(j.Payload)
+	return err
+}
+
+// ParseCommand decodes and validates a command stored in a job's payload.
+func ParseCommand(payload []byte) (*Command, error) {
+	var c Command
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, err
+	}
+
+	if len(c.Args) == 0 {
+		return nil, ErrMissingCommand
+	}
+	return &c, nil
+}
+
+// LimitedBuffer keeps the first Limit bytes written to it and silently
+// discards the rest, so that a chatty process can't exhaust memory.
+type LimitedBuffer struct {
+	bytes.Buffer
+	Limit int
+}
+
+func (b *LimitedBuffer) Write(p []byte) (int, error) {
+	if free := b.Limit - b.Len(); free > 0 {
+		if len(p) > free {
+			b.Buffer.Write(p[:free])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,129 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newJob(t *testing.T, c Command) *job.Job {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &job.Job{
+		ID:      "test-exec-job",
+		Payload: payload,
+	}
+}
+
+func Test_Execute_Command(t *testing.T) {
+	dir, err := ioutil.TempDir("", "djinn-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	j := newJob(t, Command{
+		Args:  []string{"sh", "-c", "cat > out && echo $DJINN_TEST >> out"},
+		Env:   []string{"DJINN_TEST=env"},
+		Dir:   dir,
+		Stdin: "stdin\n",
+	})
+
+	err = New(zap.NewNop()).Execute(j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ioutil.ReadFile(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != "stdin\nenv\n" {
+		t.Fatalf("invalid output: expected='%s', actual='%s'", "stdin\nenv\n", out)
+	}
+}
+
+func Test_Execute_ExitCode(t *testing.T) {
+	j := newJob(t, Command{
+		Args: []string{"sh", "-c", "echo failed >&2; exit 3"},
+	})
+
+	err := New(zap.NewNop()).Execute(j, nil)
+
+	exitErr, ok := err.(*ExitError)
+	if !ok {
+		t.Fatalf("expected exit error, actual='%v'", err)
+	}
+	if exitErr.ExitCode != 3 || exitErr.Stderr != "failed\n" {
+		t.Fatalf("invalid exit error: code=%d, stderr='%s'", exitErr.ExitCode, exitErr.Stderr)
+	}
+}
+
+func Test_LimitedBuffer(t *testing.T) {
+	b := &LimitedBuffer{Limit: 4}
+	b.Write([]byte("abc"))
+	b.Write([]byte("def"))
+
+	if b.String() != "abcd" {
+		t.Fatalf("invalid buffer contents: expected='abcd', actual='%s'", b.String())
+	}
+}
+
+func Test_ExecuteContext_Cancel(t *testing.T) {
+	j := newJob(t, Command{
+		Args: []string{"sleep", "10"},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := New(zap.NewNop()).ExecuteContext(ctx, j, nil)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", context.DeadlineExceeded, err)
+	}
+}
+
+func Test_ExecuteContext_CancelGroup(t *testing.T) {
+	// the background sleep keeps stdout open after the shell is killed
+	j := newJob(t, Command{
+		Args: []string{"sh", "-c", "sleep 10 & sleep 10"},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := New(zap.NewNop()).ExecuteContext(ctx, j, nil)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", context.DeadlineExceeded, err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("cancellation held up: %s", d)
+	}
+}
+
+func Test_Execute_ZeroExecutor(t *testing.T) {
+	if err := new(Executor).Execute(newJob(t, Command{Args: []string{"true"}}), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_ExecuteContext_Result(t *testing.T) {
+	j := newJob(t, Command{
+		Args: []string{"sh", "-c", "echo output; exit 2"},
+	})
+
+	res, _ := New(zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if res.ExitCode != 2 || res.Output != "output\n" {
+		t.Fatalf("invalid result: exit_code=%d, output='%s'", res.ExitCode, res.Output)
+	}
+}
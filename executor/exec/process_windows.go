@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package exec
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup leaves the command in djinn's process group, only the
+// command itself is killed
+func setProcessGroup(cmd *exec.Cmd) {}
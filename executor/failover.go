@@ -0,0 +1,133 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"github.com/mewa/djinn/djinn/job"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net"
+)
+
+// Backend is one of the executors tried by a Failover.
+type Backend struct {
+	// recorded in the result of executions run by the backend
+	Name     string
+	Executor Executor
+}
+
+// FailoverFunc reports whether an execution which failed with err
+// should be retried with the next backend.
+type FailoverFunc func(err error) bool
+
+// Failover runs jobs with the first of its backends, falling over to
+// the following ones in order when an execution fails with an error
+// accepted by When, Unreachable if it's nil. The name of the backend
+// whose result is returned is recorded in it.
+type Failover struct {
+	Backends []Backend
+	When     FailoverFunc
+}
+
+func NewFailover(when FailoverFunc, backends ...Backend) *Failover {
+	return &Failover{
+		Backends: backends,
+		When:     when,
+	}
+}
+
+// implements executor.ContextExecutor
+func (f *Failover) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	if len(f.Backends) == 0 {
+		return nil, ErrNoBackends
+	}
+
+	var res *job.Result
+	var err error
+	for i, b := range f.Backends {
+		res, err = WithContext(b.Executor).ExecuteContext(ctx, j, rm)
+		if res == nil {
+			res = &job.Result{}
+		}
+		res.Backend = b.Name
+
+		// cancelled executions aren't retried elsewhere
+		if err == nil || ctx.Err() != nil || i == len(f.Backends)-1 || !f.when(err) {
+			break
+		}
+	}
+	return res, err
+}
+
+func (f *Failover) when(err error) bool {
+	if f.When == nil {
+		return Unreachable(err)
+	}
+	return f.When(err)
+}
+
+// implements executor.Executor
+func (f *Failover) Execute(j *job.Job, rm job.Remover) error {
+	_, err := f.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+// implements executor.Validator, jobs must be valid for every backend
+// since any of them may end up running it
+func (f *Failover) Validate(j *job.Job) error {
+	if len(f.Backends) == 0 {
+		return ErrNoBackends
+	}
+
+	for _, b := range f.Backends {
+		if v, ok := b.Executor.(Validator); ok {
+			if err := v.Validate(j); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Unreachable fails over when the target of an execution couldn't be
+// reached, i.e. it couldn't be resolved or connected to, or a gRPC call
+// failed as unavailable.
+func Unreachable(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) && grpcErr.GRPCStatus().Code() == codes.Unavailable {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// OnErrors fails over on any of the given errors, including errors
+// wrapping them.
+func OnErrors(errs ...error) FailoverFunc {
+	return func(err error) bool {
+		for _, target := range errs {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Any combines fns, failing over when any of them does.
+func Any(fns ...FailoverFunc) FailoverFunc {
+	return func(err error) bool {
+		for _, fn := range fns {
+			if fn(err) {
+				return true
+			}
+		}
+		return false
+	}
+}
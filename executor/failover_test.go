@@ -0,0 +1,114 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"github.com/mewa/djinn/djinn/job"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net"
+	"testing"
+)
+
+func failing(err error, calls *int) ExecuteFunc {
+	return func(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+		*calls++
+		return nil, err
+	}
+}
+
+func Test_Failover_Fallback(t *testing.T) {
+	var primary, secondary, backup int
+	f := NewFailover(OnErrors(ErrTimeout),
+		Backend{"primary", failing(ErrTimeout, &primary)},
+		Backend{"secondary", failing(ErrTimeout, &secondary)},
+		Backend{"backup", failing(nil, &backup)},
+	)
+
+	res, err := f.ExecuteContext(context.Background(), &job.Job{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary != 1 || secondary != 1 || backup != 1 {
+		t.Fatalf("invalid calls: primary=%d, secondary=%d, backup=%d", primary, secondary, backup)
+	}
+	if res.Backend != "backup" {
+		t.Fatalf("invalid backend: expected='backup', actual='%s'", res.Backend)
+	}
+}
+
+func Test_Failover_Stop(t *testing.T) {
+	var primary, backup int
+	f := NewFailover(OnErrors(ErrTimeout),
+		Backend{"primary", failing(errInvalid, &primary)},
+		Backend{"backup", failing(nil, &backup)},
+	)
+
+	res, err := f.ExecuteContext(context.Background(), &job.Job{}, nil)
+	if err != errInvalid {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", errInvalid, err)
+	}
+	if backup != 0 {
+		t.Fatalf("backup executed on an unhandled error")
+	}
+	if res.Backend != "primary" {
+		t.Fatalf("invalid backend: expected='primary', actual='%s'", res.Backend)
+	}
+}
+
+func Test_Failover_Validate(t *testing.T) {
+	f := NewFailover(Unreachable,
+		Backend{"primary", &testExecutor{}},
+		Backend{"backup", &testValidator{}},
+	)
+
+	if err := f.Validate(&job.Job{}); err != errInvalid {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", errInvalid, err)
+	}
+}
+
+func Test_Unreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	_, err = net.Dial("tcp", addr)
+	if err == nil {
+		t.Fatalf("dial to a closed listener succeeded")
+	}
+	if !Unreachable(err) {
+		t.Fatalf("dial error not considered unreachable: %v", err)
+	}
+	if Unreachable(errors.New("internal server error")) {
+		t.Fatalf("unrelated error considered unreachable")
+	}
+
+	if !Unreachable(status.Error(codes.Unavailable, "connection refused")) {
+		t.Fatalf("unavailable gRPC error not considered unreachable")
+	}
+	if Unreachable(status.Error(codes.Internal, "internal error")) {
+		t.Fatalf("internal gRPC error considered unreachable")
+	}
+}
+
+func Test_Failover_DefaultWhen(t *testing.T) {
+	var primary, backup int
+	f := NewFailover(nil,
+		Backend{"primary", failing(status.Error(codes.Unavailable, "unavailable"), &primary)},
+		Backend{"backup", failing(nil, &backup)},
+	)
+
+	res, err := f.ExecuteContext(context.Background(), &job.Job{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary != 1 || backup != 1 {
+		t.Fatalf("invalid calls: primary=%d, backup=%d", primary, backup)
+	}
+	if res.Backend != "backup" {
+		t.Fatalf("invalid backend: expected='backup', actual='%s'", res.Backend)
+	}
+}
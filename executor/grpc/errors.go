@@ -0,0 +1,9 @@
+package grpc
+
+import (
+	"errors"
+)
+
+var (
+	ErrMissingTarget = errors.New("missing call target")
+)
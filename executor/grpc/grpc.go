@@ -0,0 +1,151 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor/grpc/jobrunner"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"sync"
+	"time"
+)
+
+// Call describes the JobRunner.Run call made on every run of a job. It
+// is decoded from the job's payload.
+type Call struct {
+	Target   string            `json:"target"`
+	Metadata map[string]string `json:"metadata"`
+
+	// passed to the service in JobRequest.data
+	Data string `json:"data"`
+
+	// parsed with time.ParseDuration, e.g. "30s"
+	Timeout string `json:"timeout"`
+}
+
+// Executor runs jobs by calling JobRunner services. Connections are
+// kept open and shared between jobs calling the same target.
+type Executor struct {
+	DialOptions []grpc.DialOption
+
+	// used when a job doesn't specify its own timeout
+	Timeout time.Duration
+
+	conns map[string]*grpc.ClientConn
+	mu    *sync.Mutex
+}
+
+func New(opts ...grpc.DialOption) *Executor {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+
+	return &Executor{
+		DialOptions: opts,
+		Timeout:     30 * time.Second,
+
+		conns: map[string]*grpc.ClientConn{},
+		mu:    new(sync.Mutex),
+	}
+}
+
+// implements executor.Executor
+func (ex *Executor) Execute(j *job.Job, rm job.Remover) error {
+	_, err := ex.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+// implements executor.ContextExecutor
+func (ex *Executor) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	c, timeout, err := ex.call(j)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ex.conn(c.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if len(c.Metadata) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(c.Metadata))
+	}
+
+	resp, err := jobrunner.NewJobRunnerClient(conn).Run(ctx, &jobrunner.JobRequest{
+		JobId: string(j.ID),
+		Kind:  j.Kind,
+		Time:  j.State.Time,
+		Data:  []byte(c.Data),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &job.Result{
+		Output: resp.GetOutput(),
+	}, nil
+}
+
+// implements executor.Validator
+func (ex *Executor) Validate(j *job.Job) error {
+	_, _, err := ex.call(j)
+	return err
+}
+
+// Close closes all open connections.
+func (ex *Executor) Close() error {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	var err error
+	for target, conn := range ex.conns {
+		if cerr := conn.Close(); cerr != nil {
+			err = cerr
+		}
+		delete(ex.conns, target)
+	}
+	return err
+}
+
+func (ex *Executor) call(j *job.Job) (*Call, time.Duration, error) {
+	var c Call
+	if err := json.Unmarshal(j.Payload, &c); err != nil {
+		return nil, 0, err
+	}
+
+	if c.Target == "" {
+		return nil, 0, ErrMissingTarget
+	}
+
+	timeout := ex.Timeout
+	if c.Timeout != "" {
+		t, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, 0, err
+		}
+		timeout = t
+	}
+	return &c, timeout, nil
+}
+
+func (ex *Executor) conn(target string) (*grpc.ClientConn, error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	if conn, ok := ex.conns[target]; ok {
+		return conn, nil
+	}
+
+	// dialing is non-blocking, connection errors are reported by calls
+	conn, err := grpc.Dial(target, ex.DialOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	ex.conns[target] = conn
+	return conn, nil
+}
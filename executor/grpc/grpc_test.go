@@ -0,0 +1,128 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor/grpc/jobrunner"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net"
+	"testing"
+	"time"
+)
+
+type testRunner struct {
+	requests chan *jobrunner.JobRequest
+	metadata chan metadata.MD
+}
+
+func (r *testRunner) Run(ctx context.Context, req *jobrunner.JobRequest) (*jobrunner.JobResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.requests <- req
+	r.metadata <- md
+
+	switch string(req.Data) {
+	case "fail":
+		return nil, status.Error(codes.Internal, "failed")
+	case "sleep":
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &jobrunner.JobResponse{Output: "done"}, nil
+}
+
+func newServer(t *testing.T) (*testRunner, string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &testRunner{
+		requests: make(chan *jobrunner.JobRequest, 1),
+		metadata: make(chan metadata.MD, 1),
+	}
+
+	srv := grpc.NewServer()
+	jobrunner.RegisterJobRunnerServer(srv, runner)
+	go srv.Serve(l)
+
+	return runner, l.Addr().String(), srv.Stop
+}
+
+func newJob(t *testing.T, c Call) *job.Job {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &job.Job{
+		ID:      "test-grpc-job",
+		Kind:    "grpc",
+		State:   job.State{State: job.Starting, Time: 42},
+		Payload: payload,
+	}
+}
+
+func Test_ExecuteContext(t *testing.T) {
+	runner, target, stop := newServer(t)
+	defer stop()
+
+	ex := New()
+	defer ex.Close()
+
+	j := newJob(t, Call{
+		Target:   target,
+		Metadata: map[string]string{"x-djinn": "test"},
+		Data:     "data",
+	})
+
+	res, err := ex.ExecuteContext(context.Background(), j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Output != "done" {
+		t.Fatalf("invalid output: expected='done', actual='%s'", res.Output)
+	}
+
+	req := <-runner.requests
+	if req.JobId != string(j.ID) || req.Kind != "grpc" || req.Time != 42 || string(req.Data) != "data" {
+		t.Fatalf("invalid request: %v", req)
+	}
+
+	md := <-runner.metadata
+	if v := md.Get("x-djinn"); len(v) != 1 || v[0] != "test" {
+		t.Fatalf("invalid metadata: %v", md)
+	}
+}
+
+func Test_ExecuteContext_Error(t *testing.T) {
+	_, target, stop := newServer(t)
+	defer stop()
+
+	ex := New()
+	defer ex.Close()
+
+	_, err := ex.ExecuteContext(context.Background(), newJob(t, Call{Target: target, Data: "fail"}), nil)
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("invalid error: expected='%s', actual='%v'", codes.Internal, err)
+	}
+}
+
+func Test_ExecuteContext_Deadline(t *testing.T) {
+	_, target, stop := newServer(t)
+	defer stop()
+
+	ex := New()
+	defer ex.Close()
+
+	start := time.Now()
+	_, err := ex.ExecuteContext(context.Background(), newJob(t, Call{Target: target, Data: "sleep", Timeout: "50ms"}), nil)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("invalid error: expected='%s', actual='%v'", codes.DeadlineExceeded, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("deadline not respected")
+	}
+}
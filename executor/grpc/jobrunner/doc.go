@@ -0,0 +1,6 @@
+// Package jobrunner contains the messages and service bindings of the
+// JobRunner service, generated from jobrunner.proto with protoc-gen-go
+// and its grpc plugin, which match the grpc version djinn is built with.
+package jobrunner
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. jobrunner.proto
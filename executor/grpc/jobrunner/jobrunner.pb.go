@@ -0,0 +1,227 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: jobrunner.proto
+
+package jobrunner
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type JobRequest struct {
+	JobId string `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Kind  string `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"`
+	// scheduled time of the execution, in seconds since the epoch
+	Time int64 `protobuf:"varint,3,opt,name=time,proto3" json:"time,omitempty"`
+	// job specific data, passed through as configured on the job
+	Data                 []byte   `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *JobRequest) Reset()         { *m = JobRequest{} }
+func (m *JobRequest) String() string { return proto.CompactTextString(m) }
+func (*JobRequest) ProtoMessage()    {}
+func (*JobRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_jobrunner_9b81c882288d99cd, []int{0}
+}
+func (m *JobRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_JobRequest.Unmarshal(m, b)
+}
+func (m *JobRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_JobRequest.Marshal(b, m, deterministic)
+}
+func (dst *JobRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_JobRequest.Merge(dst, src)
+}
+func (m *JobRequest) XXX_Size() int {
+	return xxx_messageInfo_JobRequest.Size(m)
+}
+func (m *JobRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_JobRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_JobRequest proto.InternalMessageInfo
+
+func (m *JobRequest) GetJobId() string {
+	if m != nil {
+		return m.JobId
+	}
+	return ""
+}
+
+func (m *JobRequest) GetKind() string {
+	if m != nil {
+		return m.Kind
+	}
+	return ""
+}
+
+func (m *JobRequest) GetTime() int64 {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
+func (m *JobRequest) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+type JobResponse struct {
+	// output recorded in the execution result
+	Output               string   `protobuf:"bytes,1,opt,name=output,proto3" json:"output,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *JobResponse) Reset()         { *m = JobResponse{} }
+func (m *JobResponse) String() string { return proto.CompactTextString(m) }
+func (*JobResponse) ProtoMessage()    {}
+func (*JobResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_jobrunner_9b81c882288d99cd, []int{1}
+}
+func (m *JobResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_JobResponse.Unmarshal(m, b)
+}
+func (m *JobResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_JobResponse.Marshal(b, m, deterministic)
+}
+func (dst *JobResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_JobResponse.Merge(dst, src)
+}
+func (m *JobResponse) XXX_Size() int {
+	return xxx_messageInfo_JobResponse.Size(m)
+}
+func (m *JobResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_JobResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_JobResponse proto.InternalMessageInfo
+
+func (m *JobResponse) GetOutput() string {
+	if m != nil {
+		return m.Output
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*JobRequest)(nil), "djinn.jobrunner.JobRequest")
+	proto.RegisterType((*JobResponse)(nil), "djinn.jobrunner.JobResponse")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// JobRunnerClient is the client API for JobRunner service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type JobRunnerClient interface {
+	// Run runs a single execution of a job. Returning an error status
+	// fails the execution.
+	Run(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*JobResponse, error)
+}
+
+type jobRunnerClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewJobRunnerClient(cc *grpc.ClientConn) JobRunnerClient {
+	return &jobRunnerClient{cc}
+}
+
+func (c *jobRunnerClient) Run(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*JobResponse, error) {
+	out := new(JobResponse)
+	err := c.cc.Invoke(ctx, "/djinn.jobrunner.JobRunner/Run", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// JobRunnerServer is the server API for JobRunner service.
+type JobRunnerServer interface {
+	// Run runs a single execution of a job. Returning an error status
+	// fails the execution.
+	Run(context.Context, *JobRequest) (*JobResponse, error)
+}
+
+func RegisterJobRunnerServer(s *grpc.Server, srv JobRunnerServer) {
+	s.RegisterService(&_JobRunner_serviceDesc, srv)
+}
+
+func _JobRunner_Run_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JobRunnerServer).Run(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/djinn.jobrunner.JobRunner/Run",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JobRunnerServer).Run(ctx, req.(*JobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _JobRunner_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "djinn.jobrunner.JobRunner",
+	HandlerType: (*JobRunnerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Run",
+			Handler:    _JobRunner_Run_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "jobrunner.proto",
+}
+
+func init() { proto.RegisterFile("jobrunner.proto", fileDescriptor_jobrunner_9b81c882288d99cd) }
+
+var fileDescriptor_jobrunner_9b81c882288d99cd = []byte{
+	// 195 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xcf, 0xca, 0x4f, 0x2a,
+	0x2a, 0xcd, 0xcb, 0x4b, 0x2d, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x4f, 0xc9, 0xca,
+	0xcc, 0xcb, 0xd3, 0x83, 0x0b, 0x2b, 0xc5, 0x73, 0x71, 0x79, 0xe5, 0x27, 0x05, 0xa5, 0x16, 0x96,
+	0xa6, 0x16, 0x97, 0x08, 0x89, 0x72, 0xb1, 0x65, 0xe5, 0x27, 0xc5, 0x67, 0xa6, 0x48, 0x30, 0x2a,
+	0x30, 0x6a, 0x70, 0x06, 0xb1, 0x66, 0xe5, 0x27, 0x79, 0xa6, 0x08, 0x09, 0x71, 0xb1, 0x64, 0x67,
+	0xe6, 0xa5, 0x48, 0x30, 0x81, 0x05, 0xc1, 0x6c, 0x90, 0x58, 0x49, 0x66, 0x6e, 0xaa, 0x04, 0xb3,
+	0x02, 0xa3, 0x06, 0x73, 0x10, 0x98, 0x0d, 0x12, 0x4b, 0x49, 0x2c, 0x49, 0x94, 0x60, 0x51, 0x60,
+	0xd4, 0xe0, 0x09, 0x02, 0xb3, 0x95, 0x54, 0xb9, 0xb8, 0xc1, 0x16, 0x14, 0x17, 0xe4, 0xe7, 0x15,
+	0xa7, 0x0a, 0x89, 0x71, 0xb1, 0xe5, 0x97, 0x96, 0x14, 0x94, 0x96, 0x40, 0x6d, 0x80, 0xf2, 0x8c,
+	0x7c, 0xb9, 0x38, 0x41, 0xca, 0xc0, 0x8e, 0x12, 0x72, 0xe0, 0x62, 0x0e, 0x2a, 0xcd, 0x13, 0x92,
+	0xd6, 0x43, 0x73, 0xad, 0x1e, 0xc2, 0xa9, 0x52, 0x32, 0xd8, 0x25, 0x21, 0xd6, 0x38, 0x71, 0x47,
+	0x71, 0xc2, 0x25, 0x92, 0xd8, 0xc0, 0x7e, 0x37, 0x06, 0x0c, 0x00, 0x29, 0x86, 0xd6, 0xdd, 0x0e,
+	0x01, 0x00, 0x00,
+}
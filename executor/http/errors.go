@@ -0,0 +1,10 @@
+package http
+
+import (
+	"errors"
+)
+
+var (
+	ErrMissingURL     = errors.New("missing request url")
+	ErrInvalidTimeout = errors.New("request timeout has to be positive")
+)
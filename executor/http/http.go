@@ -0,0 +1,158 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mewa/djinn/djinn/job"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Request describes the HTTP request issued on every run of a job. It
+// is decoded from the job's payload.
+type Request struct {
+	Method string            `json:"method"`
+	URL    string            `json:"url"`
+	Header map[string]string `json:"header"`
+	Body   string            `json:"body"`
+
+	// parsed with time.ParseDuration, e.g. "30s"
+	Timeout string `json:"timeout"`
+
+	// when set, 202 Accepted responses leave the execution running until
+	// it's completed through a callback, with the token sent in the
+	// TokenHeader of the response
+	Async bool `json:"async"`
+}
+
+const TokenHeader = "Execution-Token"
+
+// StatusError is returned for responses with a non-2xx status code.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response status: %s", e.Status)
+}
+
+type Executor struct {
+	// http.DefaultClient if nil
+	Client *http.Client
+
+	// used when a job doesn't specify its own timeout, requests don't
+	// time out if it's zero
+	Timeout time.Duration
+
+	// maximum number of response body bytes recorded in the result
+	MaxOutput int64
+}
+
+func New() *Executor {
+	return &Executor{
+		Client:    http.DefaultClient,
+		Timeout:   30 * time.Second,
+		MaxOutput: 4 * 1024,
+	}
+}
+
+// implements executor.Executor
+func (ex *Executor) Execute(j *job.Job, rm job.Remover) error {
+	_, err := ex.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+// implements executor.ContextExecutor
+func (ex *Executor) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	req, timeout, async, err := ex.request(j)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	client := ex.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body bytes.Buffer
+	io.CopyN(&body, resp.Body, ex.MaxOutput)
+
+	// drain the body so that the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	res := &job.Result{
+		StatusCode: resp.StatusCode,
+		Output:     body.String(),
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return res, &StatusError{resp.StatusCode, resp.Status}
+	}
+
+	if async && resp.StatusCode == http.StatusAccepted {
+		res.Outcome = job.OutcomeAccepted
+		res.Token = resp.Header.Get(TokenHeader)
+	}
+	return res, nil
+}
+
+// implements executor.Validator
+func (ex *Executor) Validate(j *job.Job) error {
+	_, _, _, err := ex.request(j)
+	return err
+}
+
+func (ex *Executor) request(j *job.Job) (*http.Request, time.Duration, bool, error) {
+	var r Request
+	if err := json.Unmarshal(j.Payload, &r); err != nil {
+		return nil, 0, false, err
+	}
+
+	if r.URL == "" {
+		return nil, 0, false, ErrMissingURL
+	}
+
+	method := r.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	timeout := ex.Timeout
+	if r.Timeout != "" {
+		t, err := time.ParseDuration(r.Timeout)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if t <= 0 {
+			return nil, 0, false, ErrInvalidTimeout
+		}
+		timeout = t
+	}
+
+	req, err := http.NewRequest(method, r.URL, bytes.NewBufferString(r.Body))
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	for k, v := range r.Header {
+		req.Header.Set(k, v)
+	}
+	return req, timeout, r.Async, nil
+}
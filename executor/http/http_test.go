@@ -0,0 +1,129 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newJob(t *testing.T, req Request) *job.Job {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &job.Job{
+		ID:      "test-http-job",
+		Payload: payload,
+	}
+}
+
+func Test_Execute_Request(t *testing.T) {
+	var method, header, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+
+		method = r.Method
+		header = r.Header.Get("X-Djinn")
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	j := newJob(t, Request{
+		Method: "PUT",
+		URL:    srv.URL,
+		Header: map[string]string{"X-Djinn": "test"},
+		Body:   "payload",
+	})
+
+	err := New().Execute(j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if method != "PUT" || header != "test" || body != "payload" {
+		t.Fatalf("invalid request: method='%s', header='%s', body='%s'", method, header, body)
+	}
+}
+
+func Test_Execute_StatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	err := New().Execute(newJob(t, Request{URL: srv.URL}), nil)
+
+	statusErr, ok := err.(*StatusError)
+	if !ok {
+		t.Fatalf("expected status error, actual='%v'", err)
+	}
+	if statusErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("invalid status code: expected='%d', actual='%d'", http.StatusBadGateway, statusErr.StatusCode)
+	}
+}
+
+func Test_ExecuteContext_Accepted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(TokenHeader, "test-token")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	res, err := New().ExecuteContext(context.Background(), newJob(t, Request{URL: srv.URL, Async: true}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Outcome != job.OutcomeAccepted {
+		t.Fatalf("invalid outcome: expected='%s', actual='%s'", job.OutcomeAccepted, res.Outcome)
+	}
+	if res.Token != "test-token" {
+		t.Fatalf("invalid token: expected='test-token', actual='%s'", res.Token)
+	}
+}
+
+func Test_Execute_Timeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	err := New().Execute(newJob(t, Request{URL: srv.URL, Timeout: "50ms"}), nil)
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+}
+
+func Test_Execute_MissingURL(t *testing.T) {
+	err := New().Execute(newJob(t, Request{}), nil)
+	if err != ErrMissingURL {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrMissingURL, err)
+	}
+}
+
+func Test_Validate_Timeout(t *testing.T) {
+	for _, timeout := range []string{"0s", "-1s"} {
+		err := New().Validate(newJob(t, Request{URL: "http://localhost", Timeout: timeout}))
+		if err != ErrInvalidTimeout {
+			t.Fatalf("invalid error for '%s': expected='%v', actual='%v'", timeout, ErrInvalidTimeout, err)
+		}
+	}
+}
+
+func Test_Execute_ZeroExecutor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	if err := new(Executor).Execute(newJob(t, Request{URL: srv.URL}), nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,9 +1,68 @@
 package executor
 
 import (
+	"context"
 	"github.com/mewa/djinn/djinn/job"
+	"runtime/debug"
 )
 
 type Executor interface {
 	Execute(job *job.Job, rm job.Remover) error
 }
+
+// ContextExecutor is implemented by executors whose executions can be
+// cancelled. Djinn cancels the context when the job is deleted, when the
+// node loses leadership or when it is stopped. The returned result may
+// be nil if the executor has nothing to add to what djinn records.
+type ContextExecutor interface {
+	ExecuteContext(ctx context.Context, job *job.Job, rm job.Remover) (*job.Result, error)
+}
+
+// Validator is implemented by executors which are able to reject jobs
+// they won't be able to run before they are scheduled.
+type Validator interface {
+	Validate(job *job.Job) error
+}
+
+type adapter struct {
+	Executor
+}
+
+// WithContext adapts ex to ContextExecutor. Executors already
+// implementing it are returned unchanged. Executions of other ones run
+// in their own goroutine, their panics are returned as a *PanicError.
+// They can't be interrupted, so they are abandoned once ctx is done and
+// ctx.Err() is returned in place of their result, their goroutine keeps
+// running until Execute returns.
+func WithContext(ex Executor) ContextExecutor {
+	if cex, ok := ex.(ContextExecutor); ok {
+		return cex
+	}
+	return &adapter{ex}
+}
+
+func (a *adapter) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- &PanicError{r, debug.Stack()}
+			}
+		}()
+		done <- a.Execute(j, rm)
+	}()
+
+	select {
+	case err := <-done:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (a *adapter) Validate(j *job.Job) error {
+	if v, ok := a.Executor.(Validator); ok {
+		return v.Validate(j)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package executor
+
+import (
+	"context"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/utils"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware wraps an executor adding behaviour around its executions.
+type Middleware func(next ContextExecutor) ContextExecutor
+
+// ExecuteFunc allows using ordinary functions as executors.
+type ExecuteFunc func(ctx context.Context, job *job.Job, rm job.Remover) (*job.Result, error)
+
+func (fn ExecuteFunc) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	return fn(ctx, j, rm)
+}
+
+func (fn ExecuteFunc) Execute(j *job.Job, rm job.Remover) error {
+	_, err := fn(context.Background(), j, rm)
+	return err
+}
+
+type wrapped struct {
+	next    ContextExecutor
+	execute ExecuteFunc
+}
+
+// Wrap returns an executor running jobs with fn, which is expected to
+// call next. Validation is delegated to next, so that wrapping doesn't
+// hide it from djinn.
+func Wrap(next ContextExecutor, fn ExecuteFunc) ContextExecutor {
+	return &wrapped{next, fn}
+}
+
+func (w *wrapped) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	return w.execute(ctx, j, rm)
+}
+
+func (w *wrapped) Execute(j *job.Job, rm job.Remover) error {
+	_, err := w.execute(context.Background(), j, rm)
+	return err
+}
+
+func (w *wrapped) Validate(j *job.Job) error {
+	if v, ok := w.next.(Validator); ok {
+		return v.Validate(j)
+	}
+	return nil
+}
+
+// Chain wraps ex with middlewares, the first one being the outermost.
+func Chain(ex ContextExecutor, middlewares ...Middleware) ContextExecutor {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		ex = middlewares[i](ex)
+	}
+	return ex
+}
+
+// Timeout cancels executions which don't finish within d.
+func Timeout(d time.Duration) Middleware {
+	return func(next ContextExecutor) ContextExecutor {
+		return Wrap(next, func(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			res, err := next.ExecuteContext(ctx, j, rm)
+			if err != nil && ctx.Err() == context.DeadlineExceeded {
+				return res, ErrTimeout
+			}
+			return res, err
+		})
+	}
+}
+
+// Retry retries failed executions with a randomised backoff, starting at
+// min, for as long as timeout. Cancelled executions aren't retried, nor
+// waited for. The number of attempts is recorded in the result.
+func Retry(min, timeout time.Duration) Middleware {
+	return func(next ContextExecutor) ContextExecutor {
+		return Wrap(next, func(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+			var res *job.Result
+			var err error
+			var attempt int
+
+			utils.BackoffContext(ctx, min, timeout, func() error {
+				attempt++
+				res, err = next.ExecuteContext(ctx, j, rm)
+				return err
+			})
+
+			if res == nil {
+				res = &job.Result{}
+			}
+			res.Attempt = attempt
+			return res, err
+		})
+	}
+}
+
+// Recover turns panics raised by executions into a *PanicError.
+func Recover() Middleware {
+	return func(next ContextExecutor) ContextExecutor {
+		return Wrap(next, func(ctx context.Context, j *job.Job, rm job.Remover) (res *job.Result, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &PanicError{r, debug.Stack()}
+				}
+			}()
+			return next.ExecuteContext(ctx, j, rm)
+		})
+	}
+}
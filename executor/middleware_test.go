@@ -0,0 +1,149 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"github.com/mewa/djinn/djinn/job"
+	"testing"
+	"time"
+)
+
+func Test_Recover(t *testing.T) {
+	ex := Chain(ExecuteFunc(func(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+		panic("boom")
+	}), Recover())
+
+	_, err := ex.ExecuteContext(context.Background(), &job.Job{}, nil)
+
+	panicErr, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("expected panic error, actual='%v'", err)
+	}
+	if panicErr.Value != "boom" {
+		t.Fatalf("invalid panic value: expected='boom', actual='%v'", panicErr.Value)
+	}
+}
+
+// legacy only implements Executor
+type legacy struct{}
+
+func (legacy) Execute(j *job.Job, rm job.Remover) error {
+	panic("boom")
+}
+
+func Test_Recover_WithContext(t *testing.T) {
+	ex := Chain(WithContext(legacy{}), Recover())
+
+	_, err := ex.ExecuteContext(context.Background(), &job.Job{}, nil)
+
+	panicErr, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("expected panic error, actual='%v'", err)
+	}
+	if panicErr.Value != "boom" {
+		t.Fatalf("invalid panic value: expected='boom', actual='%v'", panicErr.Value)
+	}
+}
+
+func Test_Retry(t *testing.T) {
+	var calls int
+	ex := Chain(ExecuteFunc(func(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+		calls++
+		if calls < 3 {
+			return nil, errors.New("failed")
+		}
+		return nil, nil
+	}), Retry(time.Millisecond, time.Second))
+
+	res, err := ex.ExecuteContext(context.Background(), &job.Job{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || res.Attempt != 3 {
+		t.Fatalf("invalid number of attempts: expected=3, calls=%d, attempt=%d", calls, res.Attempt)
+	}
+}
+
+func Test_Retry_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls int
+	ex := Chain(ExecuteFunc(func(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+		calls++
+		cancel()
+		return nil, errors.New("failed")
+	}), Retry(time.Minute, time.Hour))
+
+	done := make(chan struct{})
+	go func() {
+		ex.ExecuteContext(ctx, &job.Job{}, nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("retry kept waiting after cancellation")
+	}
+	if calls != 1 {
+		t.Fatalf("invalid number of attempts: expected='1', actual='%d'", calls)
+	}
+}
+
+func Test_Timeout(t *testing.T) {
+	ex := Chain(ExecuteFunc(func(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}), Timeout(10*time.Millisecond))
+
+	if _, err := ex.ExecuteContext(context.Background(), &job.Job{}, nil); err != ErrTimeout {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrTimeout, err)
+	}
+}
+
+func Test_Chain_Order(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next ContextExecutor) ContextExecutor {
+			return Wrap(next, func(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+				order = append(order, name)
+				return next.ExecuteContext(ctx, j, rm)
+			})
+		}
+	}
+
+	ex := Chain(WithContext(&testValidator{}), mw("outer"), mw("inner"))
+	ex.ExecuteContext(context.Background(), &job.Job{}, nil)
+
+	if len(order) != 2 || order[0] != "outer" || order[1] != "inner" {
+		t.Fatalf("invalid middleware order: %v", order)
+	}
+
+	// validation must not be hidden by middlewares
+	if err := ex.(Validator).Validate(&job.Job{}); err != errInvalid {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", errInvalid, err)
+	}
+}
+
+func Test_WithContext_Cancel(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	ex := WithContext(&blockingExecutor{block})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := ex.ExecuteContext(ctx, &job.Job{}, nil); err != context.Canceled {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", context.Canceled, err)
+	}
+}
+
+type blockingExecutor struct {
+	block chan struct{}
+}
+
+func (ex *blockingExecutor) Execute(j *job.Job, rm job.Remover) error {
+	<-ex.block
+	return nil
+}
@@ -0,0 +1,76 @@
+package executor
+
+import (
+	"context"
+	"github.com/mewa/djinn/djinn/job"
+	"sync"
+)
+
+// Mux dispatches jobs to the executor registered for their kind.
+type Mux struct {
+	executors map[string]Executor
+
+	mu *sync.RWMutex
+}
+
+func NewMux() *Mux {
+	return &Mux{
+		executors: map[string]Executor{},
+		mu:        new(sync.RWMutex),
+	}
+}
+
+// Handle registers the executor for the given kind, replacing the
+// previously registered one.
+func (m *Mux) Handle(kind string, ex Executor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.executors[kind] = ex
+}
+
+// Remove unregisters the executor for the given kind, unless another
+// executor has replaced it in the meantime.
+func (m *Mux) Remove(kind string, ex Executor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.executors[kind] == ex {
+		delete(m.executors, kind)
+	}
+}
+
+func (m *Mux) Executor(kind string) Executor {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.executors[kind]
+}
+
+// implements executor.ContextExecutor
+func (m *Mux) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	ex := m.Executor(j.Kind)
+	if ex == nil {
+		return nil, ErrUnknownKind
+	}
+	return WithContext(ex).ExecuteContext(ctx, j, rm)
+}
+
+// implements executor.Executor
+func (m *Mux) Execute(j *job.Job, rm job.Remover) error {
+	_, err := m.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+// implements executor.Validator
+func (m *Mux) Validate(j *job.Job) error {
+	ex := m.Executor(j.Kind)
+	if ex == nil {
+		return ErrUnknownKind
+	}
+
+	if v, ok := ex.(Validator); ok {
+		return v.Validate(j)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"errors"
+	"github.com/mewa/djinn/djinn/job"
+	"testing"
+)
+
+var errInvalid = errors.New("invalid")
+
+type testExecutor struct {
+	executed []job.ID
+}
+
+func (ex *testExecutor) Execute(j *job.Job, rm job.Remover) error {
+	ex.executed = append(ex.executed, j.ID)
+	return nil
+}
+
+type testValidator struct {
+	testExecutor
+}
+
+func (ex *testValidator) Validate(j *job.Job) error {
+	return errInvalid
+}
+
+func Test_Mux_Execute(t *testing.T) {
+	noop := &testExecutor{}
+
+	m := NewMux()
+	m.Handle("noop", noop)
+
+	err := m.Execute(&job.Job{ID: "test-mux-job", Kind: "noop"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(noop.executed) != 1 || noop.executed[0] != "test-mux-job" {
+		t.Fatalf("job not dispatched: executed='%v'", noop.executed)
+	}
+
+	err = m.Execute(&job.Job{ID: "test-mux-job", Kind: "http"}, nil)
+	if err != ErrUnknownKind {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrUnknownKind, err)
+	}
+}
+
+func Test_Mux_Validate(t *testing.T) {
+	m := NewMux()
+	m.Handle("noop", &testExecutor{})
+	m.Handle("invalid", &testValidator{})
+
+	if err := m.Validate(&job.Job{Kind: "noop"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := m.Validate(&job.Job{Kind: "invalid"}); err != errInvalid {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", errInvalid, err)
+	}
+	if err := m.Validate(&job.Job{Kind: "unknown"}); err != ErrUnknownKind {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrUnknownKind, err)
+	}
+}
+
+func Test_Mux_Remove(t *testing.T) {
+	first, second := &testExecutor{}, &testExecutor{}
+
+	m := NewMux()
+	m.Handle("noop", first)
+	m.Handle("noop", second)
+
+	m.Remove("noop", first)
+	if m.Executor("noop") != second {
+		t.Fatalf("replacing executor removed")
+	}
+
+	m.Remove("noop", second)
+	if ex := m.Executor("noop"); ex != nil {
+		t.Fatalf("invalid executor: expected='<nil>', actual='%v'", ex)
+	}
+}
@@ -0,0 +1,23 @@
+package plugin
+
+import (
+	"errors"
+)
+
+var (
+	ErrNotRunning = errors.New("plugin is not running")
+	ErrExited     = errors.New("plugin exited")
+	ErrClosed     = errors.New("plugin closed")
+
+	ErrStartTimeout = errors.New("plugin did not report its kinds in time")
+)
+
+// ExecutionError is a failure reported by the plugin.
+type ExecutionError struct {
+	Plugin  string
+	Message string
+}
+
+func (e *ExecutionError) Error() string {
+	return e.Plugin + ": " + e.Message
+}
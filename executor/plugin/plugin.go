@@ -0,0 +1,355 @@
+package plugin
+
+import (
+	"context"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Plugin is an executor running jobs in a plugin process. The process is
+// restarted whenever it exits, executions running at that time fail.
+type Plugin struct {
+	Path string
+
+	// delays between restarts of a crashing plugin, growing from the
+	// first to the second
+	RestartDelay    time.Duration
+	MaxRestartDelay time.Duration
+
+	// time a started process has to report the kinds it handles
+	StartTimeout time.Duration
+
+	kinds []string
+
+	// mux the plugin is registered in, see Load
+	mux *executor.Mux
+
+	client *rpc.Client
+	cmd    *exec.Cmd
+
+	// closed once the running process exits
+	exited chan struct{}
+
+	// last execution id
+	id uint64
+
+	closed bool
+	stop   chan struct{}
+
+	log *zap.Logger
+
+	mu *sync.Mutex
+}
+
+func New(path string, log *zap.Logger) *Plugin {
+	return &Plugin{
+		Path: path,
+
+		RestartDelay:    100 * time.Millisecond,
+		MaxRestartDelay: 30 * time.Second,
+
+		StartTimeout: 10 * time.Second,
+
+		stop: make(chan struct{}),
+
+		log: log,
+
+		mu: new(sync.Mutex),
+	}
+}
+
+// Load starts all executables in dir as plugins, registering them in m
+// for the kinds they handle. Plugins which fail to start are skipped.
+func Load(dir string, m *executor.Mux, log *zap.Logger) ([]*Plugin, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var plugins []*Plugin
+	for _, f := range files {
+		path := filepath.Join(dir, f.Name())
+
+		// follows symlinks
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+
+		p := New(path, log)
+		p.mux = m
+
+		err = p.Start()
+		if err != nil {
+			log.Error("could not start plugin", zap.String("plugin", p.Path), zap.Error(err))
+			continue
+		}
+
+		p.register(nil)
+		plugins = append(plugins, p)
+
+		log.Info("plugin loaded", zap.String("plugin", p.Path), zap.Strings("kinds", p.Kinds()))
+	}
+	return plugins, nil
+}
+
+// Start launches the plugin process.
+func (p *Plugin) Start() error {
+	cmd := exec.Command(p.Path)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	client := jsonrpc.NewClient(&conn{stdout, stdin})
+
+	var kinds KindsResponse
+	call := client.Go(ServiceName+".Kinds", struct{}{}, &kinds, nil)
+
+	timer := time.NewTimer(p.StartTimeout)
+	select {
+	case <-call.Done:
+		err = call.Error
+	case <-timer.C:
+		err = ErrStartTimeout
+	}
+	timer.Stop()
+
+	if err != nil {
+		client.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	exited := make(chan struct{})
+
+	p.mu.Lock()
+	// Close can't stop a process it hasn't seen
+	if p.closed {
+		p.mu.Unlock()
+		client.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		return ErrClosed
+	}
+	p.client = client
+	p.cmd = cmd
+	p.exited = exited
+	p.kinds = kinds.Kinds
+	p.mu.Unlock()
+
+	go p.monitor(cmd, client, exited)
+	return nil
+}
+
+// register registers the plugin in its mux for the kinds it handles,
+// unregistering it from the previous kinds it no longer handles
+func (p *Plugin) register(previous []string) {
+	if p.mux == nil {
+		return
+	}
+
+	kinds := p.Kinds()
+
+	handled := map[string]bool{}
+	for _, kind := range kinds {
+		handled[kind] = true
+		p.mux.Handle(kind, p)
+	}
+	for _, kind := range previous {
+		if !handled[kind] {
+			p.mux.Remove(kind, p)
+		}
+	}
+}
+
+// Kinds returns the job kinds the plugin handles.
+func (p *Plugin) Kinds() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.kinds
+}
+
+// Close stops the plugin, giving it the timeout to exit on its own.
+func (p *Plugin) Close(timeout time.Duration) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.stop)
+
+	client, cmd, exited := p.client, p.cmd, p.exited
+	p.mu.Unlock()
+
+	if client == nil {
+		return nil
+	}
+
+	// plugins exit once their input is closed
+	client.Close()
+
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(timeout):
+		return cmd.Process.Kill()
+	}
+}
+
+// monitor restarts the plugin once its process exits
+func (p *Plugin) monitor(cmd *exec.Cmd, client *rpc.Client, exited chan struct{}) {
+	err := cmd.Wait()
+	client.Close()
+	close(exited)
+
+	p.mu.Lock()
+	p.client = nil
+	closed := p.closed
+	p.mu.Unlock()
+
+	if closed {
+		return
+	}
+	p.log.Error("plugin exited", zap.String("plugin", p.Path), zap.Error(err))
+
+	previous := p.Kinds()
+
+	delay := p.RestartDelay
+	for {
+		select {
+		case <-time.After(delay):
+		case <-p.stop:
+			return
+		}
+
+		err := p.Start()
+		if err == ErrClosed {
+			return
+		}
+		if err == nil {
+			// the new process could handle other kinds
+			p.register(previous)
+			p.log.Info("plugin restarted", zap.String("plugin", p.Path), zap.Strings("kinds", p.Kinds()))
+			return
+		}
+		p.log.Error("could not restart plugin", zap.String("plugin", p.Path), zap.Error(err))
+
+		delay *= 2
+		if delay > p.MaxRestartDelay {
+			delay = p.MaxRestartDelay
+		}
+	}
+}
+
+// callError maps the error of a failed call, errors returned by the
+// plugin are reported as such and broken connections as ErrExited
+func (p *Plugin) callError(err error) error {
+	if serr, ok := err.(rpc.ServerError); ok {
+		return &ExecutionError{p.Path, string(serr)}
+	}
+	if err == rpc.ErrShutdown || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrExited
+	}
+	if _, ok := err.(*os.PathError); ok {
+		return ErrExited
+	}
+	return err
+}
+
+func (p *Plugin) connection() (*rpc.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client == nil {
+		return nil, ErrNotRunning
+	}
+	return p.client, nil
+}
+
+// implements executor.Executor
+func (p *Plugin) Execute(j *job.Job, rm job.Remover) error {
+	_, err := p.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+// implements executor.ContextExecutor
+func (p *Plugin) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	client, err := p.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	req := &ExecuteRequest{
+		ID:  atomic.AddUint64(&p.id, 1),
+		Job: *j,
+	}
+
+	var resp ExecuteResponse
+	call := client.Go(ServiceName+".Execute", req, &resp, nil)
+
+	select {
+	case <-call.Done:
+	case <-ctx.Done():
+		// the plugin is asked to stop, but we don't wait for it
+		client.Go(ServiceName+".Cancel", &CancelRequest{req.ID}, &struct{}{}, nil)
+		return nil, ctx.Err()
+	}
+
+	if call.Error != nil {
+		return nil, p.callError(call.Error)
+	}
+
+	if resp.Remove && rm != nil {
+		rm.Remove(j)
+	}
+
+	if resp.Error != "" {
+		return resp.Result, &ExecutionError{p.Path, resp.Error}
+	}
+	return resp.Result, nil
+}
+
+// implements executor.Validator
+func (p *Plugin) Validate(j *job.Job) error {
+	client, err := p.connection()
+	if err != nil {
+		return err
+	}
+
+	var resp ValidateResponse
+	err = client.Call(ServiceName+".Validate", j, &resp)
+	if err != nil {
+		return p.callError(err)
+	}
+
+	if resp.Error != "" {
+		return &ExecutionError{p.Path, resp.Error}
+	}
+	return nil
+}
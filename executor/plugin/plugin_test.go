@@ -0,0 +1,353 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the test binary serves as the plugin when this is set
+const pluginEnv = "DJINN_TEST_PLUGIN"
+
+// file listing the kinds served by the test plugin, if set
+const kindsEnv = "DJINN_TEST_PLUGIN_KINDS"
+
+type testExecutor struct{}
+
+func (ex *testExecutor) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	switch string(j.Payload) {
+	case `"crash"`:
+		os.Exit(1)
+	case `"fail"`:
+		return &job.Result{Output: "failed"}, errors.New("failure")
+	case `"block"`:
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case `"remove"`:
+		rm.Remove(j)
+	}
+	return &job.Result{Output: j.Kind}, nil
+}
+
+func (ex *testExecutor) Execute(j *job.Job, rm job.Remover) error {
+	_, err := ex.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+func (ex *testExecutor) Validate(j *job.Job) error {
+	if string(j.Payload) == `"invalid"` {
+		return errors.New("invalid payload")
+	}
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(pluginEnv) {
+	case "":
+	case "hang":
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	default:
+		kinds := []string{"test", "other"}
+		if path := os.Getenv(kindsEnv); path != "" {
+			data, _ := ioutil.ReadFile(path)
+			kinds = strings.Fields(string(data))
+		}
+		Serve(&testExecutor{}, kinds...)
+		os.Exit(0)
+	}
+
+	os.Setenv(pluginEnv, "1")
+	os.Exit(m.Run())
+}
+
+func newPlugin(t *testing.T) *Plugin {
+	p := New(os.Args[0], zap.NewNop())
+	p.RestartDelay = 10 * time.Millisecond
+
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func newJob(payload string) *job.Job {
+	return &job.Job{
+		ID:      "test-plugin-job",
+		Kind:    "test",
+		Payload: []byte(`"` + payload + `"`),
+	}
+}
+
+type testRemover struct {
+	removed bool
+}
+
+func (r *testRemover) Remove(j *job.Job) error {
+	r.removed = true
+	return nil
+}
+
+func Test_Start_Kinds(t *testing.T) {
+	p := newPlugin(t)
+	defer p.Close(time.Second)
+
+	kinds := p.Kinds()
+	if len(kinds) != 2 || kinds[0] != "test" || kinds[1] != "other" {
+		t.Fatalf("invalid kinds: expected='[test other]', actual='%v'", kinds)
+	}
+}
+
+func Test_ExecuteContext(t *testing.T) {
+	p := newPlugin(t)
+	defer p.Close(time.Second)
+
+	rm := &testRemover{}
+	res, err := p.ExecuteContext(context.Background(), newJob("remove"), rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Output != "test" {
+		t.Fatalf("invalid output: expected='test', actual='%s'", res.Output)
+	}
+	if !rm.removed {
+		t.Fatalf("job not removed")
+	}
+}
+
+func Test_ExecuteContext_Error(t *testing.T) {
+	p := newPlugin(t)
+	defer p.Close(time.Second)
+
+	res, err := p.ExecuteContext(context.Background(), newJob("fail"), nil)
+
+	execErr, ok := err.(*ExecutionError)
+	if !ok || execErr.Message != "failure" {
+		t.Fatalf("invalid error: expected='failure', actual='%v'", err)
+	}
+	if res.Output != "failed" {
+		t.Fatalf("invalid output: expected='failed', actual='%s'", res.Output)
+	}
+}
+
+func Test_ExecuteContext_Cancel(t *testing.T) {
+	p := newPlugin(t)
+	defer p.Close(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := p.ExecuteContext(ctx, newJob("block"), nil)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", context.DeadlineExceeded, err)
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	p := newPlugin(t)
+	defer p.Close(time.Second)
+
+	if err := p.Validate(newJob("valid")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Validate(newJob("invalid")); err == nil {
+		t.Fatalf("invalid payload accepted")
+	}
+}
+
+func Test_ExecuteContext_Restart(t *testing.T) {
+	p := newPlugin(t)
+	defer p.Close(time.Second)
+
+	_, err := p.ExecuteContext(context.Background(), newJob("crash"), nil)
+	if err != ErrExited {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrExited, err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err = p.ExecuteContext(context.Background(), newJob("ok"), nil)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("plugin not restarted: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_Load(t *testing.T) {
+	dir, err := os.MkdirTemp("", "djinn-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = os.Symlink(os.Args[0], dir+"/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// not executable, so it's skipped
+	err = os.WriteFile(dir+"/README", []byte("plugins"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := executor.NewMux()
+	plugins, err := Load(dir, m, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range plugins {
+		defer p.Close(time.Second)
+	}
+
+	if len(plugins) != 1 {
+		t.Fatalf("invalid number of plugins: expected='1', actual='%d'", len(plugins))
+	}
+	if m.Executor("other") != plugins[0] {
+		t.Fatalf("plugin not registered for kind 'other'")
+	}
+}
+
+func Test_Start_Closed(t *testing.T) {
+	p := New(os.Args[0], zap.NewNop())
+	p.Close(time.Second)
+
+	if err := p.Start(); err != ErrClosed {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrClosed, err)
+	}
+	if _, err := p.connection(); err != ErrNotRunning {
+		t.Fatalf("closed plugin started")
+	}
+}
+
+func Test_CallError(t *testing.T) {
+	p := newPlugin(t)
+	defer p.Close(time.Second)
+
+	client, err := p.connection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// errors returned by the plugin don't mean it exited
+	err = p.callError(client.Call(ServiceName+".Unknown", struct{}{}, &struct{}{}))
+	if _, ok := err.(*ExecutionError); !ok {
+		t.Fatalf("invalid error: expected='*ExecutionError', actual='%v'", err)
+	}
+}
+
+func Test_Load_Restart(t *testing.T) {
+	m := executor.NewMux()
+
+	p := New(os.Args[0], zap.NewNop())
+	p.RestartDelay = 10 * time.Millisecond
+	p.mux = m
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close(time.Second)
+
+	p.ExecuteContext(context.Background(), newJob("crash"), nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Executor("test") != p {
+		if time.Now().After(deadline) {
+			t.Fatalf("restarted plugin not registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_Start_Timeout(t *testing.T) {
+	os.Setenv(pluginEnv, "hang")
+	defer os.Setenv(pluginEnv, "1")
+
+	p := New(os.Args[0], zap.NewNop())
+	p.StartTimeout = 50 * time.Millisecond
+
+	err := p.Start()
+	if err != ErrStartTimeout {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrStartTimeout, err)
+	}
+}
+
+func Test_Load_RestartKinds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "djinn-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kinds")
+	if err := ioutil.WriteFile(path, []byte("test other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(kindsEnv, path)
+	defer os.Unsetenv(kindsEnv)
+
+	m := executor.NewMux()
+
+	p := New(os.Args[0], zap.NewNop())
+	p.RestartDelay = 10 * time.Millisecond
+	p.mux = m
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close(time.Second)
+	p.register(nil)
+
+	if err := ioutil.WriteFile(path, []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p.ExecuteContext(context.Background(), newJob("crash"), nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Executor("other") != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("kind no longer handled still registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m.Executor("test") != p {
+		t.Fatalf("restarted plugin not registered")
+	}
+}
+
+func Test_Serve_CancelBeforeExecute(t *testing.T) {
+	c, s := net.Pipe()
+	go ServeConn(s, &testExecutor{}, "test")
+
+	client := rpc.NewClientWithCodec(jsonrpc.NewClientCodec(c))
+	defer client.Close()
+
+	err := client.Call(ServiceName+".Cancel", &CancelRequest{1}, &struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resp ExecuteResponse
+	call := client.Go(ServiceName+".Execute", &ExecuteRequest{1, *newJob("block")}, &resp, nil)
+
+	select {
+	case <-call.Done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("cancelled execution not stopped")
+	}
+	if resp.Error != context.Canceled.Error() {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", context.Canceled, resp.Error)
+	}
+}
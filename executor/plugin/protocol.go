@@ -0,0 +1,55 @@
+// Package plugin runs executors in separate processes. Plugins are
+// executables speaking JSON-RPC over their standard input and output,
+// which is what Serve implements for plugin authors.
+package plugin
+
+import (
+	"github.com/mewa/djinn/djinn/job"
+	"io"
+)
+
+// ServiceName is the RPC service plugins register.
+const ServiceName = "Plugin"
+
+type KindsResponse struct {
+	// job kinds the plugin handles
+	Kinds []string `json:"kinds"`
+}
+
+type ExecuteRequest struct {
+	// identifies the execution in cancel requests
+	ID  uint64  `json:"id"`
+	Job job.Job `json:"job"`
+}
+
+type ExecuteResponse struct {
+	Result *job.Result `json:"result"`
+
+	// non-empty if the execution failed
+	Error string `json:"error"`
+
+	// set when the job asked to be removed through job.Remover
+	Remove bool `json:"remove"`
+}
+
+type ValidateResponse struct {
+	Error string `json:"error"`
+}
+
+type CancelRequest struct {
+	ID uint64 `json:"id"`
+}
+
+// conn joins a pair of pipes into a connection
+type conn struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (c *conn) Close() error {
+	err := c.WriteCloser.Close()
+	if rerr := c.ReadCloser.Close(); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"context"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sync"
+)
+
+// Serve serves ex for the given kinds to the djinn which launched the
+// plugin, returning once djinn closes the connection. Plugins must not
+// write to their standard output, which carries the protocol.
+func Serve(ex executor.Executor, kinds ...string) error {
+	return ServeConn(&conn{os.Stdin, os.Stdout}, ex, kinds...)
+}
+
+// ServeConn is like Serve, but it serves on the given connection.
+func ServeConn(c io.ReadWriteCloser, ex executor.Executor, kinds ...string) error {
+	s := &server{
+		executor: executor.WithContext(ex),
+		kinds:    kinds,
+		cancels:  map[uint64]context.CancelFunc{},
+		pending:  map[uint64]bool{},
+		mu:       new(sync.Mutex),
+	}
+
+	srv := rpc.NewServer()
+	err := srv.RegisterName(ServiceName, s)
+	if err != nil {
+		return err
+	}
+
+	srv.ServeCodec(jsonrpc.NewServerCodec(c))
+
+	// djinn is gone, nobody is waiting for the executions anymore
+	s.mu.Lock()
+	for _, cancel := range s.cancels {
+		cancel()
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+type server struct {
+	executor executor.ContextExecutor
+	kinds    []string
+
+	// cancel functions of running executions
+	cancels map[uint64]context.CancelFunc
+
+	// executions cancelled before they started, requests are served
+	// concurrently, so a cancel can overtake its execution; cancels
+	// racing with a finished execution stay here, but they're rare
+	pending map[uint64]bool
+
+	mu *sync.Mutex
+}
+
+func (s *server) Kinds(req struct{}, resp *KindsResponse) error {
+	resp.Kinds = s.kinds
+	return nil
+}
+
+func (s *server) Execute(req *ExecuteRequest, resp *ExecuteResponse) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.mu.Lock()
+	if s.pending[req.ID] {
+		delete(s.pending, req.ID)
+		cancel()
+	}
+	s.cancels[req.ID] = cancel
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.cancels, req.ID)
+		s.mu.Unlock()
+	}()
+
+	rm := &executor.RemoveRecorder{}
+	res, err := s.executor.ExecuteContext(ctx, &req.Job, rm)
+
+	resp.Result = res
+	resp.Remove = rm.Removed
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return nil
+}
+
+func (s *server) Validate(j *job.Job, resp *ValidateResponse) error {
+	if v, ok := s.executor.(executor.Validator); ok {
+		if err := v.Validate(j); err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	return nil
+}
+
+func (s *server) Cancel(req *CancelRequest, resp *struct{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cancel, ok := s.cancels[req.ID]; ok {
+		cancel()
+	} else {
+		s.pending[req.ID] = true
+	}
+	return nil
+}
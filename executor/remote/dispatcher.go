@@ -0,0 +1,265 @@
+package remote
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/mewa/djinn/djinn/job"
+	"go.uber.org/zap"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type completion struct {
+	result *job.Result
+	err    error
+}
+
+type execution struct {
+	Execution
+
+	rm job.Remover
+
+	worker  string
+	lease   *time.Timer
+	expires time.Time
+
+	done chan completion
+}
+
+// Dispatcher is an executor which queues executions for workers instead
+// of running them. Workers claim executions over HTTP, served by the
+// dispatcher's handler, and keep them leased with heartbeats. Executions
+// whose lease expires are handed out again.
+//
+// Executions are only queued on the leader, workers are expected to poll
+// all djinn nodes.
+type Dispatcher struct {
+	LeaseTimeout time.Duration
+	MaxAttempts  int
+
+	// upper bound of the time a claim request waits for an execution
+	MaxWait time.Duration
+
+	queue   []*execution
+	claimed map[string]*execution
+
+	// closed and replaced whenever an execution is queued
+	queued chan struct{}
+
+	router http.Handler
+
+	log *zap.Logger
+
+	mu *sync.Mutex
+}
+
+func NewDispatcher(log *zap.Logger) *Dispatcher {
+	d := &Dispatcher{
+		LeaseTimeout: 30 * time.Second,
+		MaxAttempts:  3,
+		MaxWait:      time.Minute,
+
+		claimed: map[string]*execution{},
+		queued:  make(chan struct{}),
+
+		log: log,
+
+		mu: new(sync.Mutex),
+	}
+	d.router = d.routes()
+
+	return d
+}
+
+// implements executor.Executor
+func (d *Dispatcher) Execute(j *job.Job, rm job.Remover) error {
+	_, err := d.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+// implements executor.ContextExecutor, it returns once a worker completes
+// the execution
+func (d *Dispatcher) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	e := &execution{
+		Execution: Execution{
+			ID:  newID(),
+			Job: *j,
+		},
+		rm:   rm,
+		done: make(chan completion, 1),
+	}
+
+	d.mu.Lock()
+	d.enqueue(e)
+	d.mu.Unlock()
+
+	select {
+	case c := <-e.done:
+		return c.result, c.err
+	case <-ctx.Done():
+		d.mu.Lock()
+		d.drop(e)
+		d.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// enqueue queues the execution for its next attempt, d.mu must be held
+func (d *Dispatcher) enqueue(e *execution) {
+	e.Attempt++
+	e.worker = ""
+
+	d.queue = append(d.queue, e)
+
+	close(d.queued)
+	d.queued = make(chan struct{})
+}
+
+// drop forgets the execution, d.mu must be held
+func (d *Dispatcher) drop(e *execution) {
+	if e.lease != nil {
+		e.lease.Stop()
+	}
+	delete(d.claimed, e.ID)
+
+	for i, queued := range d.queue {
+		if queued == e {
+			d.queue = append(d.queue[:i], d.queue[i+1:]...)
+			break
+		}
+	}
+}
+
+// claim hands out the oldest queued execution the worker can run, waiting
+// for one for at most wait
+func (d *Dispatcher) claim(ctx context.Context, req *ClaimRequest, wait time.Duration) *Execution {
+	if wait > d.MaxWait {
+		wait = d.MaxWait
+	}
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for {
+		d.mu.Lock()
+		for i, e := range d.queue {
+			if !handles(req.Kinds, e.Job.Kind) {
+				continue
+			}
+
+			d.queue = append(d.queue[:i], d.queue[i+1:]...)
+			d.claimed[e.ID] = e
+
+			e.worker = req.Worker
+			e.Lease = int64(d.LeaseTimeout / time.Millisecond)
+			e.expires = time.Now().Add(d.LeaseTimeout)
+			e.lease = time.AfterFunc(d.LeaseTimeout, func() {
+				d.expire(e)
+			})
+
+			// e is modified under the lock once its lease expires
+			claimed := e.Execution
+			d.mu.Unlock()
+
+			d.log.Info("execution claimed", zap.String("execution", claimed.ID), zap.String("job_id", string(claimed.Job.ID)), zap.String("worker", req.Worker), zap.Int("attempt", claimed.Attempt))
+			return &claimed
+		}
+		queued := d.queued
+		d.mu.Unlock()
+
+		select {
+		case <-queued:
+		case <-timeout.C:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// expire hands the execution out again once its lease expires, or fails
+// it after too many attempts
+func (d *Dispatcher) expire(e *execution) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// the lease could have been extended while we were waiting
+	if d.claimed[e.ID] != e || time.Now().Before(e.expires) {
+		return
+	}
+	delete(d.claimed, e.ID)
+
+	d.log.Info("execution lease expired", zap.String("execution", e.ID), zap.String("job_id", string(e.Job.ID)), zap.String("worker", e.worker), zap.Int("attempt", e.Attempt))
+
+	if e.Attempt >= d.MaxAttempts {
+		e.done <- completion{&job.Result{Attempt: e.Attempt}, ErrLeaseExpired}
+		return
+	}
+	d.enqueue(e)
+}
+
+// heartbeat extends the lease of an execution claimed by the worker
+func (d *Dispatcher) heartbeat(id string, req *HeartbeatRequest) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e := d.claimed[id]
+	if e == nil || e.worker != req.Worker {
+		return ErrLeaseLost
+	}
+
+	e.expires = time.Now().Add(d.LeaseTimeout)
+	e.lease.Reset(d.LeaseTimeout)
+	return nil
+}
+
+// complete finishes an execution claimed by the worker
+func (d *Dispatcher) complete(id string, req *CompleteRequest) error {
+	d.mu.Lock()
+	e := d.claimed[id]
+	if e == nil || e.worker != req.Worker {
+		d.mu.Unlock()
+		return ErrLeaseLost
+	}
+	d.drop(e)
+	d.mu.Unlock()
+
+	d.log.Info("execution completed", zap.String("execution", e.ID), zap.String("job_id", string(e.Job.ID)), zap.String("worker", req.Worker), zap.String("error", req.Error))
+
+	if req.Remove && e.rm != nil {
+		e.rm.Remove(&e.Job)
+	}
+
+	res := req.Result
+	if res == nil {
+		res = &job.Result{}
+	}
+	res.Attempt = e.Attempt
+
+	var err error
+	if req.Error != "" {
+		err = &ExecutionError{req.Worker, req.Error}
+	}
+
+	e.done <- completion{res, err}
+	return nil
+}
+
+func handles(kinds []string, kind string) bool {
+	if len(kinds) == 0 {
+		return true
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,66 @@
+package remote
+
+import (
+	"context"
+	"github.com/mewa/djinn/djinn/job"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func Test_Dispatcher_LeaseExpired(t *testing.T) {
+	d := NewDispatcher(zap.NewNop())
+	d.LeaseTimeout = 20 * time.Millisecond
+	d.MaxAttempts = 2
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := d.ExecuteContext(context.Background(), &job.Job{ID: "test-lease-job"}, nil)
+		done <- err
+	}()
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		e := d.claim(context.Background(), &ClaimRequest{Worker: "test-worker"}, time.Second)
+		if e == nil || e.Attempt != attempt {
+			t.Fatalf("invalid claimed execution: expected attempt=%d, actual='%v'", attempt, e)
+		}
+	}
+
+	select {
+	case err := <-done:
+		if err != ErrLeaseExpired {
+			t.Fatalf("invalid error: expected='%v', actual='%v'", ErrLeaseExpired, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+func Test_Dispatcher_Kinds(t *testing.T) {
+	d := NewDispatcher(zap.NewNop())
+
+	go d.ExecuteContext(context.Background(), &job.Job{ID: "test-kind-job", Kind: "http"}, nil)
+
+	if e := d.claim(context.Background(), &ClaimRequest{Worker: "test-worker", Kinds: []string{"exec"}}, 50*time.Millisecond); e != nil {
+		t.Fatalf("claimed execution of unsupported kind: %v", e)
+	}
+	if e := d.claim(context.Background(), &ClaimRequest{Worker: "test-worker", Kinds: []string{"http"}}, time.Second); e == nil {
+		t.Fatal("execution not claimed")
+	}
+}
+
+func Test_Dispatcher_Cancel(t *testing.T) {
+	d := NewDispatcher(zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := d.ExecuteContext(ctx, &job.Job{ID: "test-cancel-job"}, nil)
+	if err != context.Canceled {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", context.Canceled, err)
+	}
+
+	if e := d.claim(context.Background(), &ClaimRequest{Worker: "test-worker"}, 10*time.Millisecond); e != nil {
+		t.Fatalf("claimed cancelled execution: %v", e)
+	}
+}
@@ -0,0 +1,21 @@
+package remote
+
+import (
+	"errors"
+)
+
+var (
+	ErrLeaseExpired = errors.New("execution lease expired too many times")
+	ErrLeaseLost    = errors.New("execution lease lost")
+)
+
+// ExecutionError is a failure reported by the worker running the
+// execution.
+type ExecutionError struct {
+	Worker  string
+	Message string
+}
+
+func (e *ExecutionError) Error() string {
+	return e.Worker + ": " + e.Message
+}
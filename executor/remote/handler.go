@@ -0,0 +1,76 @@
+package remote
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+// ServeHTTP serves the worker API:
+//
+//	POST /claim             claims an execution, 204 if none is due
+//	POST /{id}/heartbeat    extends the lease of a claimed execution
+//	POST /{id}/complete     reports the outcome of a claimed execution
+//
+// Requests for executions whose lease was lost are answered with 410.
+func (d *Dispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.router.ServeHTTP(w, r)
+}
+
+func (d *Dispatcher) routes() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/claim", d.claimHandler).
+		Methods("POST")
+	r.HandleFunc("/{id}/heartbeat", d.heartbeatHandler).
+		Methods("POST")
+	r.HandleFunc("/{id}/complete", d.completeHandler).
+		Methods("POST")
+	return r
+}
+
+func (d *Dispatcher) claimHandler(w http.ResponseWriter, r *http.Request) {
+	var req ClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	e := d.claim(r.Context(), &req, time.Duration(req.Wait)*time.Millisecond)
+	if e == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	data, _ := json.Marshal(e)
+	w.Write(data)
+}
+
+func (d *Dispatcher) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	var req HeartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if err := d.heartbeat(mux.Vars(r)["id"], &req); err != nil {
+		w.WriteHeader(http.StatusGone)
+		w.Write([]byte(err.Error()))
+	}
+}
+
+func (d *Dispatcher) completeHandler(w http.ResponseWriter, r *http.Request) {
+	var req CompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if err := d.complete(mux.Vars(r)["id"], &req); err != nil {
+		w.WriteHeader(http.StatusGone)
+		w.Write([]byte(err.Error()))
+	}
+}
@@ -0,0 +1,41 @@
+package remote
+
+import (
+	"github.com/mewa/djinn/djinn/job"
+)
+
+// Execution is handed out to a worker claiming work.
+type Execution struct {
+	ID      string  `json:"id"`
+	Job     job.Job `json:"job"`
+	Attempt int     `json:"attempt"`
+
+	// milliseconds the worker has to send a heartbeat in, before the
+	// execution is handed out to another worker
+	Lease int64 `json:"lease"`
+}
+
+type ClaimRequest struct {
+	Worker string `json:"worker"`
+
+	// kinds of jobs the worker can run, empty means any
+	Kinds []string `json:"kinds"`
+
+	// milliseconds to wait for an execution before giving up
+	Wait int64 `json:"wait"`
+}
+
+type HeartbeatRequest struct {
+	Worker string `json:"worker"`
+}
+
+type CompleteRequest struct {
+	Worker string      `json:"worker"`
+	Result *job.Result `json:"result"`
+
+	// non-empty if the execution failed
+	Error string `json:"error"`
+
+	// set when the job asked to be removed through job.Remover
+	Remove bool `json:"remove"`
+}
@@ -0,0 +1,17 @@
+package executor
+
+import (
+	"github.com/mewa/djinn/djinn/job"
+)
+
+// RemoveRecorder is a job.Remover for executions running away from
+// djinn, it records the job's request to be removed so that djinn can
+// remove it once the execution completes.
+type RemoveRecorder struct {
+	Removed bool
+}
+
+func (r *RemoveRecorder) Remove(j *job.Job) error {
+	r.Removed = true
+	return nil
+}
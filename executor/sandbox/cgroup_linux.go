@@ -0,0 +1,93 @@
+//go:build linux
+// +build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/mewa/djinn/djinn/job"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cgroup period used for cpu.max, in microseconds
+const cpuPeriod = 100000
+
+type cgroup struct {
+	path string
+	fd   int
+}
+
+// newCgroup creates a cgroup for a single execution of the job
+func newCgroup(conf *Cgroup, id job.ID) (*cgroup, error) {
+	name := fmt.Sprintf("%s-%d", strings.Replace(string(id), "/", "_", -1), time.Now().UnixNano())
+	path := filepath.Join(conf.Root, name)
+
+	err := os.Mkdir(path, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	cg := &cgroup{path: path, fd: -1}
+
+	if conf.Memory > 0 {
+		err = cg.write("memory.max", fmt.Sprint(conf.Memory))
+		if err != nil {
+			cg.remove()
+			return nil, err
+		}
+		// without swap the limit is enforced by the OOM killer,
+		// not every system has swap accounting enabled though
+		cg.write("memory.swap.max", "0")
+	}
+
+	if conf.CPU > 0 {
+		err = cg.write("cpu.max", fmt.Sprintf("%d %d", int64(conf.CPU*cpuPeriod), cpuPeriod))
+		if err != nil {
+			cg.remove()
+			return nil, err
+		}
+	}
+
+	cg.fd, err = syscall.Open(path, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		cg.remove()
+		return nil, err
+	}
+	return cg, nil
+}
+
+func (cg *cgroup) write(file, value string) error {
+	return ioutil.WriteFile(filepath.Join(cg.path, file), []byte(value), 0644)
+}
+
+// oomKilled tells whether the OOM killer killed any process in the cgroup
+func (cg *cgroup) oomKilled() bool {
+	data, err := ioutil.ReadFile(filepath.Join(cg.path, "memory.events"))
+	if err != nil {
+		return false
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		var count int
+		if n, _ := fmt.Sscanf(s.Text(), "oom_kill %d", &count); n == 1 {
+			return count > 0
+		}
+	}
+	return false
+}
+
+// remove removes the cgroup, it has to be empty by then
+func (cg *cgroup) remove() {
+	if cg.fd >= 0 {
+		syscall.Close(cg.fd)
+	}
+	os.Remove(cg.path)
+}
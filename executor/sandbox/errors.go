@@ -0,0 +1,12 @@
+package sandbox
+
+import (
+	"errors"
+)
+
+var (
+	ErrMemoryExceeded = errors.New("memory limit exceeded")
+	ErrCPUExceeded    = errors.New("cpu time limit exceeded")
+	ErrUnsupported    = errors.New("sandboxing is not supported on this platform")
+	ErrNotStopped     = errors.New("process didn't stop at exec")
+)
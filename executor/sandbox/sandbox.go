@@ -0,0 +1,102 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor/exec"
+	"go.uber.org/zap"
+)
+
+// Limits restrict resources available to a process. Zero values mean no
+// limit.
+type Limits struct {
+	// seconds of CPU time
+	CPU uint64 `json:"cpu"`
+	// bytes of virtual memory
+	Memory    uint64 `json:"memory"`
+	OpenFiles uint64 `json:"open_files"`
+}
+
+// Cgroup places processes in a new cgroup v2 sub-tree for the duration of
+// their execution.
+type Cgroup struct {
+	// cgroup v2 directory delegated to djinn, e.g. /sys/fs/cgroup/djinn
+	Root string
+
+	// memory.max in bytes
+	Memory int64
+	// cpu.max in number of CPUs, e.g. 0.5
+	CPU float64
+}
+
+// User sets the credentials processes run with.
+type User struct {
+	UID uint32
+	GID uint32
+}
+
+// Command is an exec.Command with limits requested by the job, which
+// can only lower the limits of the executor.
+type Command struct {
+	exec.Command
+	Limits Limits `json:"limits"`
+}
+
+// Executor runs commands like exec.Executor, applying resource limits and
+// reporting their violations with job.OutcomeMemoryExceeded and
+// job.OutcomeCPUExceeded.
+type Executor struct {
+	exec.Executor
+
+	Limits Limits
+
+	// optional
+	User   *User
+	Cgroup *Cgroup
+}
+
+func New(limits Limits, log *zap.Logger) *Executor {
+	return &Executor{
+		Executor: *exec.New(log),
+		Limits:   limits,
+	}
+}
+
+// implements executor.Executor
+func (ex *Executor) Execute(j *job.Job, rm job.Remover) error {
+	_, err := ex.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+// implements executor.Validator
+func (ex *Executor) Validate(j *job.Job) error {
+	_, err := command(j)
+	return err
+}
+
+func command(j *job.Job) (*Command, error) {
+	if _, err := exec.ParseCommand(j.Payload); err != nil {
+		return nil, err
+	}
+
+	var c Command
+	err := json.Unmarshal(j.Payload, &c)
+	return &c, err
+}
+
+// lower returns the stricter of the limits
+func (l Limits) lower(other Limits) Limits {
+	return Limits{
+		CPU:       lower(l.CPU, other.CPU),
+		Memory:    lower(l.Memory, other.Memory),
+		OpenFiles: lower(l.OpenFiles, other.OpenFiles),
+	}
+}
+
+func lower(a, b uint64) uint64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
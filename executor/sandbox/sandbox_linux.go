@@ -0,0 +1,203 @@
+//go:build linux
+// +build linux
+
+package sandbox
+
+import (
+	"context"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor/exec"
+	osexec "os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// implements executor.ContextExecutor, the process is killed when ctx is
+// done
+func (ex *Executor) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	c, err := command(j)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := ex.Limits.lower(c.Limits)
+
+	var cg *cgroup
+	if ex.Cgroup != nil {
+		cg, err = newCgroup(ex.Cgroup, j.ID)
+		if err != nil {
+			return nil, err
+		}
+		defer cg.remove()
+	}
+
+	cmd, res, err := ex.Run(ctx, j, &c.Command, func(cmd *osexec.Cmd) error {
+		if ex.User != nil {
+			cmd.SysProcAttr.Credential = &syscall.Credential{
+				Uid: ex.User.UID,
+				Gid: ex.User.GID,
+			}
+		}
+
+		if cg != nil {
+			// the child is started inside the cgroup, so there is no
+			// window in which it runs unrestricted
+			cmd.SysProcAttr.UseCgroupFD = true
+			cmd.SysProcAttr.CgroupFD = cg.fd
+		}
+		return start(cmd, limits)
+	})
+	if cmd == nil || err == nil || err == ctx.Err() {
+		return res, err
+	}
+
+	if cg != nil && cg.oomKilled() {
+		res.Outcome = job.OutcomeMemoryExceeded
+		return res, ErrMemoryExceeded
+	}
+
+	if cpuExceeded(cmd, limits) {
+		res.Outcome = job.OutcomeCPUExceeded
+		return res, ErrCPUExceeded
+	}
+
+	if memoryExceeded(cmd, err, limits) {
+		res.Outcome = job.OutcomeMemoryExceeded
+		return res, ErrMemoryExceeded
+	}
+	return res, err
+}
+
+// start starts the command with limits applied. rlimits can only be set
+// once the process exists, so it's traced to stop it at exec until they
+// are in place.
+func start(cmd *osexec.Cmd, limits Limits) error {
+	// ptrace requests have to come from the thread which started the
+	// process
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	cmd.SysProcAttr.Ptrace = true
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	pid := cmd.Process.Pid
+
+	var status syscall.WaitStatus
+	_, err = syscall.Wait4(pid, &status, 0, nil)
+	if err == nil && !status.Stopped() {
+		err = ErrNotStopped
+	}
+
+	if err == nil {
+		err = setLimits(pid, limits)
+	}
+	if err == nil {
+		err = syscall.PtraceDetach(pid)
+	}
+
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	return nil
+}
+
+// cpuExceeded tells whether the process was killed for exceeding its CPU
+// time limit. The kernel sends SIGXCPU at the soft limit and SIGKILL at
+// the hard one.
+func cpuExceeded(cmd *osexec.Cmd, limits Limits) bool {
+	if limits.CPU == 0 {
+		return false
+	}
+
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return false
+	}
+
+	switch status.Signal() {
+	case syscall.SIGXCPU:
+		return true
+	case syscall.SIGKILL:
+		used := cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+		return uint64(used.Seconds()) >= limits.CPU
+	}
+	return false
+}
+
+// messages processes commonly fail with when they can't allocate memory
+var allocationFailures = []string{
+	"cannot allocate memory",
+	"out of memory",
+	"memory exhausted",
+	"bad_alloc",
+	"memoryerror",
+}
+
+// memoryExceeded tells whether the process failed for exceeding its
+// memory limit. Without a cgroup the limit is an rlimit, which fails
+// allocations instead of killing the process, so the way it failed is
+// inspected: a crash or an allocation failure reported on stderr.
+func memoryExceeded(cmd *osexec.Cmd, err error, limits Limits) bool {
+	if limits.Memory == 0 {
+		return false
+	}
+
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if ok && status.Signaled() {
+		switch status.Signal() {
+		case syscall.SIGSEGV, syscall.SIGBUS, syscall.SIGABRT:
+			return true
+		}
+	}
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+
+	stderr := strings.ToLower(exitErr.Stderr)
+	for _, msg := range allocationFailures {
+		if strings.Contains(stderr, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func setLimits(pid int, limits Limits) error {
+	if limits.CPU > 0 {
+		// leave a second between SIGXCPU and SIGKILL
+		err := prlimit(pid, syscall.RLIMIT_CPU, &syscall.Rlimit{Cur: limits.CPU, Max: limits.CPU + 1})
+		if err != nil {
+			return err
+		}
+	}
+	if limits.Memory > 0 {
+		err := prlimit(pid, syscall.RLIMIT_AS, &syscall.Rlimit{Cur: limits.Memory, Max: limits.Memory})
+		if err != nil {
+			return err
+		}
+	}
+	if limits.OpenFiles > 0 {
+		err := prlimit(pid, syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: limits.OpenFiles, Max: limits.OpenFiles})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func prlimit(pid int, resource int, limit *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(limit)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
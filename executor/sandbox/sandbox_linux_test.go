@@ -0,0 +1,106 @@
+//go:build linux
+// +build linux
+
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor/exec"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func newJob(t *testing.T, c Command) *job.Job {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &job.Job{
+		ID:      "test-sandbox-job",
+		Payload: payload,
+	}
+}
+
+func Test_ExecuteContext_CPUExceeded(t *testing.T) {
+	j := newJob(t, Command{
+		Command: exec.Command{
+			Args: []string{"sh", "-c", "while :; do :; done"},
+		},
+		Limits: Limits{CPU: 1},
+	})
+
+	res, err := New(Limits{}, zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err != ErrCPUExceeded {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrCPUExceeded, err)
+	}
+	if res.Outcome != job.OutcomeCPUExceeded {
+		t.Fatalf("invalid outcome: expected='%s', actual='%s'", job.OutcomeCPUExceeded, res.Outcome)
+	}
+}
+
+func Test_ExecuteContext_MemoryExceeded(t *testing.T) {
+	// without a cgroup the shell fails to allocate instead of being
+	// killed
+	j := newJob(t, Command{
+		Command: exec.Command{
+			Args: []string{"sh", "-c", `x=$(head -c 200000000 /dev/zero | tr "\0" a); echo ${#x}`},
+		},
+		Limits: Limits{Memory: 64 << 20},
+	})
+
+	res, err := New(Limits{}, zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err != ErrMemoryExceeded {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrMemoryExceeded, err)
+	}
+	if res.Outcome != job.OutcomeMemoryExceeded {
+		t.Fatalf("invalid outcome: expected='%s', actual='%s'", job.OutcomeMemoryExceeded, res.Outcome)
+	}
+}
+
+func Test_ExecuteContext_OpenFiles(t *testing.T) {
+	j := newJob(t, Command{
+		Command: exec.Command{
+			Args: []string{"sh", "-c", "ulimit -n"},
+		},
+	})
+
+	res, err := New(Limits{OpenFiles: 16}, zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Output != "16\n" {
+		t.Fatalf("invalid open files limit: expected='16', actual='%s'", res.Output)
+	}
+}
+
+func Test_Limits_Lower(t *testing.T) {
+	executor := Limits{CPU: 10, Memory: 1024}
+	requested := Limits{CPU: 20, Memory: 512, OpenFiles: 64}
+
+	actual := executor.lower(requested)
+	expected := Limits{CPU: 10, Memory: 512, OpenFiles: 64}
+
+	if actual != expected {
+		t.Fatalf("invalid limits: expected='%v', actual='%v'", expected, actual)
+	}
+}
+
+func Test_ExecuteContext_LimitsAtExec(t *testing.T) {
+	// the shell reads its limits as soon as it starts, they have to be
+	// in place before exec
+	j := newJob(t, Command{
+		Command: exec.Command{
+			Args: []string{"sh", "-c", "ulimit -v"},
+		},
+	})
+
+	res, err := New(Limits{Memory: 256 << 20}, zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Output != "262144\n" {
+		t.Fatalf("invalid memory limit: expected='262144', actual='%s'", res.Output)
+	}
+}
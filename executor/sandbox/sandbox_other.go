@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package sandbox
+
+import (
+	"context"
+	"github.com/mewa/djinn/djinn/job"
+)
+
+// implements executor.ContextExecutor
+func (ex *Executor) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	return nil, ErrUnsupported
+}
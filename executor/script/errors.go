@@ -0,0 +1,11 @@
+package script
+
+import (
+	"errors"
+)
+
+var (
+	ErrMissingSource = errors.New("missing script source")
+	ErrMissingRun    = errors.New("script doesn't define a run function")
+	ErrStepsExceeded = errors.New("script exceeded its step limit")
+)
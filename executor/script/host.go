@@ -0,0 +1,144 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"github.com/mewa/djinn/djinn/job"
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// limit of response bodies read by scripts
+const maxBody = 1024 * 1024
+
+// host implements the API available to scripts
+type host struct {
+	ctx    context.Context
+	client *http.Client
+
+	job *job.Job
+	rm  job.Remover
+
+	// set once the script asks for the job to be removed, which
+	// happens after it finishes
+	removed bool
+
+	log *zap.Logger
+}
+
+func (h *host) predeclared(data starlark.Value) starlark.StringDict {
+	var id, kind string
+	if h.job != nil {
+		id, kind = string(h.job.ID), h.job.Kind
+	}
+
+	return starlark.StringDict{
+		"json": starlarkjson.Module,
+		"log":  starlark.NewBuiltin("log", h.logf),
+		"job": starlarkstruct.FromStringDict(starlark.String("job"), starlark.StringDict{
+			"id":     starlark.String(id),
+			"kind":   starlark.String(kind),
+			"data":   data,
+			"remove": starlark.NewBuiltin("remove", h.remove),
+		}),
+		"http": &starlarkstruct.Module{
+			Name: "http",
+			Members: starlark.StringDict{
+				"get":  starlark.NewBuiltin("get", h.get),
+				"post": starlark.NewBuiltin("post", h.post),
+			},
+		},
+	}
+}
+
+func (h *host) logf(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	msg := make([]string, len(args))
+	for i, arg := range args {
+		if s, ok := arg.(starlark.String); ok {
+			msg[i] = string(s)
+		} else {
+			msg[i] = arg.String()
+		}
+	}
+
+	h.log.Info(strings.Join(msg, " "), zap.String("job_id", string(h.job.ID)))
+	return starlark.None, nil
+}
+
+func (h *host) remove(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+
+	if h.rm == nil {
+		return nil, fmt.Errorf("%s: jobs can't be removed here", fn.Name())
+	}
+
+	// removing the job right away would cancel the running script
+	h.removed = true
+	return starlark.None, nil
+}
+
+func (h *host) get(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var url string
+	var headers *starlark.Dict
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "url", &url, "headers?", &headers); err != nil {
+		return nil, err
+	}
+	return h.do(fn, http.MethodGet, url, nil, headers)
+}
+
+func (h *host) post(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var url, body string
+	var headers *starlark.Dict
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "url", &url, "body?", &body, "headers?", &headers); err != nil {
+		return nil, err
+	}
+	return h.do(fn, http.MethodPost, url, strings.NewReader(body), headers)
+}
+
+func (h *host) do(fn *starlark.Builtin, method, url string, body io.Reader, headers *starlark.Dict) (starlark.Value, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+
+	if headers != nil {
+		for _, item := range headers.Items() {
+			k, kok := starlark.AsString(item[0])
+			v, vok := starlark.AsString(item[1])
+			if !kok || !vok {
+				return nil, fmt.Errorf("%s: headers must be strings", fn.Name())
+			}
+			req.Header.Set(k, v)
+		}
+	}
+
+	resp, err := h.client.Do(req.WithContext(h.ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+
+	respHeaders := starlark.NewDict(len(resp.Header))
+	for k := range resp.Header {
+		respHeaders.SetKey(starlark.String(k), starlark.String(resp.Header.Get(k)))
+	}
+
+	return starlarkstruct.FromStringDict(starlark.String("response"), starlark.StringDict{
+		"status_code": starlark.MakeInt(resp.StatusCode),
+		"body":        starlark.String(data),
+		"headers":     respHeaders,
+	}), nil
+}
@@ -0,0 +1,241 @@
+// Package script runs jobs as Starlark scripts stored in their
+// definitions.
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor"
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// Script describes the script run on every run of a job. It is decoded
+// from the job's payload.
+//
+// The script has to define a run function, whose return value becomes
+// the output of the execution. Strings are used as they are, other values
+// are encoded as JSON. Besides the json module, scripts can use:
+//
+//	job.id, job.kind    of the running job
+//	job.data            Data decoded from JSON
+//	job.remove()        removes the job once the script finishes
+//	http.get(url, headers={})
+//	http.post(url, body="", headers={})
+//	                    return a struct with status_code, body and headers
+//	log(*args)          logs the arguments, print does the same
+type Script struct {
+	Source string          `json:"source"`
+	Data   json.RawMessage `json:"data"`
+
+	// can only lower the limits of the executor, zero values mean no
+	// change
+	Steps uint64 `json:"steps"`
+	// parsed with time.ParseDuration, e.g. "30s"
+	Timeout string `json:"timeout"`
+}
+
+type Executor struct {
+	Client *http.Client
+
+	// number of computation steps a script can take, zero means no
+	// limit
+	Steps uint64
+
+	// wall time a script can run for, including its HTTP calls
+	Timeout time.Duration
+
+	// maximum number of bytes of the return value recorded in the
+	// result
+	MaxOutput int
+
+	log *zap.Logger
+}
+
+func New(log *zap.Logger) *Executor {
+	return &Executor{
+		Client:    http.DefaultClient,
+		Steps:     10 * 1000 * 1000,
+		Timeout:   time.Minute,
+		MaxOutput: 64 * 1024,
+		log:       log,
+	}
+}
+
+// implements executor.Executor
+func (ex *Executor) Execute(j *job.Job, rm job.Remover) error {
+	_, err := ex.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+// implements executor.ContextExecutor, the script is stopped when ctx is
+// done
+func (ex *Executor) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	s, steps, timeout, err := ex.script(j)
+	if err != nil {
+		return nil, err
+	}
+
+	data := starlark.Value(starlark.None)
+	if len(s.Data) != 0 {
+		data, err = decode(s.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	thread := &starlark.Thread{
+		Name: string(j.ID),
+		Print: func(thread *starlark.Thread, msg string) {
+			ex.log.Info(msg, zap.String("job_id", string(j.ID)))
+		},
+	}
+	if steps != 0 {
+		thread.SetMaxExecutionSteps(steps)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	api := &host{
+		ctx:    ctx,
+		client: ex.Client,
+		job:    j,
+		rm:     rm,
+		log:    ex.log,
+	}
+
+	var value starlark.Value
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, string(j.ID), s.Source, api.predeclared(data))
+	if err == nil {
+		run, ok := globals["run"].(starlark.Callable)
+		if !ok {
+			return nil, ErrMissingRun
+		}
+		value, err = starlark.Call(thread, run, nil, nil)
+	}
+
+	if api.removed {
+		if rmErr := rm.Remove(j); rmErr != nil {
+			ex.log.Error("could not remove job", zap.String("job_id", string(j.ID)), zap.Error(rmErr))
+		}
+	}
+
+	if err != nil {
+		ex.log.Info("script failed", zap.String("job_id", string(j.ID)), zap.Uint64("steps", thread.ExecutionSteps()), zap.Error(err))
+
+		if parent.Err() != nil {
+			return nil, parent.Err()
+		}
+		if ctx.Err() != nil {
+			return nil, executor.ErrTimeout
+		}
+		if steps != 0 && thread.ExecutionSteps() >= steps {
+			return nil, ErrStepsExceeded
+		}
+		return nil, err
+	}
+
+	output, err := encode(thread, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(output) > ex.MaxOutput {
+		output = output[:ex.MaxOutput]
+	}
+
+	ex.log.Info("script finished", zap.String("job_id", string(j.ID)), zap.Uint64("steps", thread.ExecutionSteps()))
+
+	return &job.Result{
+		Output: output,
+	}, nil
+}
+
+// implements executor.Validator, scripts are checked for syntax errors,
+// undefined names and a missing run function
+func (ex *Executor) Validate(j *job.Job) error {
+	s, _, _, err := ex.script(j)
+	if err != nil {
+		return err
+	}
+
+	predeclared := (&host{}).predeclared(starlark.None)
+	f, _, err := starlark.SourceProgramOptions(&syntax.FileOptions{}, string(j.ID), s.Source, predeclared.Has)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range f.Stmts {
+		if def, ok := stmt.(*syntax.DefStmt); ok && def.Name.Name == "run" {
+			return nil
+		}
+	}
+	return ErrMissingRun
+}
+
+func (ex *Executor) script(j *job.Job) (*Script, uint64, time.Duration, error) {
+	var s Script
+	if err := json.Unmarshal(j.Payload, &s); err != nil {
+		return nil, 0, 0, err
+	}
+
+	if s.Source == "" {
+		return nil, 0, 0, ErrMissingSource
+	}
+
+	steps := ex.Steps
+	if s.Steps != 0 && (steps == 0 || s.Steps < steps) {
+		steps = s.Steps
+	}
+
+	timeout := ex.Timeout
+	if s.Timeout != "" {
+		t, err := time.ParseDuration(s.Timeout)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if t < timeout {
+			timeout = t
+		}
+	}
+	return &s, steps, timeout, nil
+}
+
+// decode converts JSON to a Starlark value
+func decode(data []byte) (starlark.Value, error) {
+	thread := &starlark.Thread{Name: "decode"}
+	return starlark.Call(thread, starlarkjson.Module.Members["decode"], starlark.Tuple{starlark.String(data)}, nil)
+}
+
+// encode converts the return value of a script to the output of its
+// execution
+func encode(thread *starlark.Thread, v starlark.Value) (string, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return "", nil
+	case starlark.String:
+		return string(v), nil
+	}
+
+	encoded, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{v}, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded.(starlark.String)), nil
+}
@@ -0,0 +1,207 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newJob(t *testing.T, s Script) *job.Job {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &job.Job{
+		ID:      "test-script-job",
+		Kind:    "script",
+		Payload: payload,
+	}
+}
+
+type testRemover struct {
+	removed bool
+}
+
+func (r *testRemover) Remove(j *job.Job) error {
+	r.removed = true
+	return nil
+}
+
+func Test_ExecuteContext_Result(t *testing.T) {
+	j := newJob(t, Script{
+		Source: `
+def run():
+    log("summing", len(job.data["values"]))
+    return {"id": job.id, "sum": sum(job.data["values"])}
+
+def sum(values):
+    total = 0
+    for v in values:
+        total += v
+    return total
+`,
+		Data: json.RawMessage(`{"values": [1, 2, 3]}`),
+	})
+
+	res, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"id":"test-script-job","sum":6}`
+	if res.Output != expected {
+		t.Fatalf("invalid output: expected='%s', actual='%s'", expected, res.Output)
+	}
+}
+
+func Test_ExecuteContext_HTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Djinn", r.Header.Get("X-Djinn"))
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	j := newJob(t, Script{
+		Source: `
+def run():
+    resp = http.post(job.data, body="ping", headers={"X-Djinn": "test"})
+    return "%d %s %s" % (resp.status_code, resp.body, resp.headers["X-Djinn"])
+`,
+		Data: json.RawMessage(`"` + srv.URL + `"`),
+	})
+
+	res, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Output != "200 ping test" {
+		t.Fatalf("invalid output: expected='200 ping test', actual='%s'", res.Output)
+	}
+}
+
+func Test_ExecuteContext_Remove(t *testing.T) {
+	j := newJob(t, Script{
+		Source: `
+def run():
+    job.remove()
+`,
+	})
+
+	rm := &testRemover{}
+	_, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rm.removed {
+		t.Fatalf("job not removed")
+	}
+}
+
+// cancelRemover cancels the execution like djinn does for deleted jobs
+type cancelRemover struct {
+	cancel context.CancelFunc
+}
+
+func (r *cancelRemover) Remove(j *job.Job) error {
+	r.cancel()
+	return nil
+}
+
+func Test_ExecuteContext_RemoveAfterRun(t *testing.T) {
+	j := newJob(t, Script{
+		Source: `
+def run():
+    job.remove()
+    return "done"
+`,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	res, err := New(zap.NewNop()).ExecuteContext(ctx, j, &cancelRemover{cancel})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Output != "done" {
+		t.Fatalf("invalid output: expected='done', actual='%s'", res.Output)
+	}
+	if ctx.Err() == nil {
+		t.Fatalf("job not removed")
+	}
+}
+
+func Test_ExecuteContext_Steps(t *testing.T) {
+	j := newJob(t, Script{
+		Source: `
+def run():
+    for i in range(1000000):
+        pass
+`,
+		Steps: 1000,
+	})
+
+	_, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err != ErrStepsExceeded {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrStepsExceeded, err)
+	}
+}
+
+func Test_ExecuteContext_Timeout(t *testing.T) {
+	j := newJob(t, Script{
+		Source: `
+def run():
+    for i in range(1000000000):
+        pass
+`,
+		Timeout: "50ms",
+	})
+
+	ex := New(zap.NewNop())
+	ex.Steps = 0
+
+	_, err := ex.ExecuteContext(context.Background(), j, nil)
+	if err != executor.ErrTimeout {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", executor.ErrTimeout, err)
+	}
+}
+
+func Test_ExecuteContext_Fail(t *testing.T) {
+	j := newJob(t, Script{
+		Source: `
+def run():
+    fail("broken")
+`,
+	})
+
+	_, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err == nil {
+		t.Fatalf("failure not reported")
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	ex := New(zap.NewNop())
+
+	err := ex.Validate(newJob(t, Script{Source: "x = 1"}))
+	if err != ErrMissingRun {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrMissingRun, err)
+	}
+
+	err = ex.Validate(newJob(t, Script{Source: "def run():\n    return undefined\n"}))
+	if err == nil {
+		t.Fatalf("undefined name accepted")
+	}
+
+	err = ex.Validate(newJob(t, Script{Source: "def run():\n    return http.get(job.data).body\n"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,23 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrMissingQuery      = errors.New("missing query or script")
+	ErrAmbiguousQuery    = errors.New("query and script are mutually exclusive")
+	ErrUnknownConnection = errors.New("unknown connection")
+)
+
+// ScriptError is returned when a query of a script fails, none of the
+// script's changes are kept.
+type ScriptError struct {
+	Query int
+	Err   error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("query %d of script failed: %v", e.Query, e.Err)
+}
@@ -0,0 +1,206 @@
+// Package sql runs SQL statements against named database/sql
+// connections.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// Statement describes the SQL run on every run of a job. It is decoded
+// from the job's payload.
+type Statement struct {
+	// name of a connection registered with the executor
+	Connection string `json:"connection"`
+
+	// either a single query with its arguments, or a script of
+	// queries run one after another in a transaction
+	Query  string        `json:"query"`
+	Args   []interface{} `json:"args"`
+	Script []string      `json:"script"`
+
+	// parsed with time.ParseDuration, e.g. "30s"
+	Timeout string `json:"timeout"`
+}
+
+type Executor struct {
+	// used when a job doesn't specify its own timeout
+	Timeout time.Duration
+
+	connections map[string]*sql.DB
+
+	log *zap.Logger
+
+	mu *sync.RWMutex
+}
+
+func New(log *zap.Logger) *Executor {
+	return &Executor{
+		Timeout:     time.Hour,
+		connections: map[string]*sql.DB{},
+		log:         log,
+		mu:          new(sync.RWMutex),
+	}
+}
+
+// Connect registers db under the given name, replacing the previously
+// registered connection.
+func (ex *Executor) Connect(name string, db *sql.DB) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	ex.connections[name] = db
+}
+
+// Open opens a connection with the given driver and registers it.
+func (ex *Executor) Open(name, driver, dsn string) error {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+
+	ex.Connect(name, db)
+	return nil
+}
+
+// Close closes all registered connections.
+func (ex *Executor) Close() error {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	var err error
+	for name, db := range ex.connections {
+		if cerr := db.Close(); cerr != nil {
+			err = cerr
+		}
+		delete(ex.connections, name)
+	}
+	return err
+}
+
+// implements executor.Executor
+func (ex *Executor) Execute(j *job.Job, rm job.Remover) error {
+	_, err := ex.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+// implements executor.ContextExecutor, statements are interrupted when
+// ctx is done
+func (ex *Executor) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	s, db, timeout, err := ex.statement(j)
+	if err != nil {
+		return nil, err
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var affected int64
+	if s.Query != "" {
+		affected, err = exec(ctx, db, s.Query, s.Args)
+	} else {
+		affected, err = script(ctx, db, s.Script)
+	}
+
+	ex.log.Info("statement finished",
+		zap.String("job_id", string(j.ID)),
+		zap.String("connection", s.Connection),
+		zap.Int64("rows_affected", affected),
+		zap.Error(err))
+
+	res := &job.Result{
+		RowsAffected: affected,
+		Output:       fmt.Sprintf("%d rows affected", affected),
+	}
+
+	if err != nil && ctx.Err() != nil {
+		if parent.Err() != nil {
+			return res, parent.Err()
+		}
+		return res, executor.ErrTimeout
+	}
+	return res, err
+}
+
+// implements executor.Validator
+func (ex *Executor) Validate(j *job.Job) error {
+	_, _, _, err := ex.statement(j)
+	return err
+}
+
+func (ex *Executor) statement(j *job.Job) (*Statement, *sql.DB, time.Duration, error) {
+	var s Statement
+	if err := json.Unmarshal(j.Payload, &s); err != nil {
+		return nil, nil, 0, err
+	}
+
+	if s.Query == "" && len(s.Script) == 0 {
+		return nil, nil, 0, ErrMissingQuery
+	}
+	if s.Query != "" && len(s.Script) != 0 {
+		return nil, nil, 0, ErrAmbiguousQuery
+	}
+
+	ex.mu.RLock()
+	db, ok := ex.connections[s.Connection]
+	ex.mu.RUnlock()
+	if !ok {
+		return nil, nil, 0, ErrUnknownConnection
+	}
+
+	timeout := ex.Timeout
+	if s.Timeout != "" {
+		t, err := time.ParseDuration(s.Timeout)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		timeout = t
+	}
+	return &s, db, timeout, nil
+}
+
+func exec(ctx context.Context, db *sql.DB, query string, args []interface{}) (int64, error) {
+	r, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return rowsAffected(r), nil
+}
+
+// script runs the queries in a transaction, rolling it back if any of
+// them fails
+func script(ctx context.Context, db *sql.DB, queries []string) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	for i, query := range queries {
+		r, err := tx.ExecContext(ctx, query)
+		if err != nil {
+			tx.Rollback()
+			return 0, &ScriptError{i, err}
+		}
+		affected += rowsAffected(r)
+	}
+	return affected, tx.Commit()
+}
+
+// rowsAffected returns the number of affected rows, if the driver
+// reports them
+func rowsAffected(r sql.Result) int64 {
+	n, err := r.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,136 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mewa/djinn/djinn/job"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func newExecutor(t *testing.T) (*Executor, *sql.DB) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection to :memory: opens a new database
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("CREATE TABLE sessions (id INTEGER PRIMARY KEY, expired INTEGER)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO sessions (expired) VALUES (1), (1), (0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex := New(zap.NewNop())
+	ex.Connect("test", db)
+	return ex, db
+}
+
+func newJob(t *testing.T, s Statement) *job.Job {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &job.Job{
+		ID:      "test-sql-job",
+		Payload: payload,
+	}
+}
+
+func count(t *testing.T, db *sql.DB) int {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func Test_ExecuteContext_Query(t *testing.T) {
+	ex, db := newExecutor(t)
+	defer ex.Close()
+
+	j := newJob(t, Statement{
+		Connection: "test",
+		Query:      "DELETE FROM sessions WHERE expired = ?",
+		Args:       []interface{}{1},
+	})
+
+	res, err := ex.ExecuteContext(context.Background(), j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RowsAffected != 2 {
+		t.Fatalf("invalid rows affected: expected='2', actual='%d'", res.RowsAffected)
+	}
+	if n := count(t, db); n != 1 {
+		t.Fatalf("invalid number of rows: expected='1', actual='%d'", n)
+	}
+}
+
+func Test_ExecuteContext_Script(t *testing.T) {
+	ex, db := newExecutor(t)
+	defer ex.Close()
+
+	j := newJob(t, Statement{
+		Connection: "test",
+		Script: []string{
+			"UPDATE sessions SET expired = 1",
+			"DELETE FROM sessions WHERE expired = 1",
+		},
+	})
+
+	res, err := ex.ExecuteContext(context.Background(), j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RowsAffected != 6 {
+		t.Fatalf("invalid rows affected: expected='6', actual='%d'", res.RowsAffected)
+	}
+	if n := count(t, db); n != 0 {
+		t.Fatalf("invalid number of rows: expected='0', actual='%d'", n)
+	}
+}
+
+func Test_ExecuteContext_ScriptRollback(t *testing.T) {
+	ex, db := newExecutor(t)
+	defer ex.Close()
+
+	j := newJob(t, Statement{
+		Connection: "test",
+		Script: []string{
+			"DELETE FROM sessions",
+			"DELETE FROM missing",
+		},
+	})
+
+	_, err := ex.ExecuteContext(context.Background(), j, nil)
+
+	scriptErr, ok := err.(*ScriptError)
+	if !ok || scriptErr.Query != 1 {
+		t.Fatalf("invalid error: expected failure of query 1, actual='%v'", err)
+	}
+	if n := count(t, db); n != 3 {
+		t.Fatalf("script not rolled back: expected='3', actual='%d'", n)
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	ex, _ := newExecutor(t)
+	defer ex.Close()
+
+	err := ex.Validate(newJob(t, Statement{Connection: "test"}))
+	if err != ErrMissingQuery {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrMissingQuery, err)
+	}
+
+	err = ex.Validate(newJob(t, Statement{Connection: "other", Query: "SELECT 1"}))
+	if err != ErrUnknownConnection {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrUnknownConnection, err)
+	}
+}
@@ -0,0 +1,23 @@
+package trigger
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mewa/djinn/djinn/job"
+)
+
+var (
+	ErrMissingJobs = errors.New("missing jobs to trigger")
+	ErrSelfTrigger = errors.New("job can't trigger itself")
+	ErrUnsupported = errors.New("triggering jobs is not supported here")
+)
+
+// Error is returned when a triggered job couldn't be run or failed.
+type Error struct {
+	Job job.ID
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("triggered job %s: %v", e.Job, e.Err)
+}
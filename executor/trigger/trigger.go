@@ -0,0 +1,127 @@
+// Package trigger provides an executor running other jobs, so that simple
+// pipelines can be built out of existing jobs.
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// Kind is the job kind the executor is meant to be registered for.
+const Kind = "trigger"
+
+// Runner runs jobs on demand. Djinn passes itself to executors as their
+// job.Remover, implementing it.
+type Runner interface {
+	// Trigger runs the job right away, the returned channel receives
+	// the error of the execution once it's done
+	Trigger(id job.ID, parent *job.Parent) (<-chan error, error)
+}
+
+// Trigger describes the jobs run on every run of a job. It is decoded
+// from the job's payload.
+type Trigger struct {
+	Jobs []job.ID `json:"jobs"`
+
+	// run the jobs one after another, each once the previous one
+	// succeeds, instead of all at once
+	Wait bool `json:"wait"`
+}
+
+// Executor triggers jobs the same way manual runs do, recording the
+// triggering execution as their parent. Jobs triggered with Wait must not
+// share a full pool with the triggering one. Djinn refuses to trigger a
+// job from an execution which it triggered itself, directly or not.
+type Executor struct {
+	log *zap.Logger
+}
+
+func New(log *zap.Logger) *Executor {
+	return &Executor{
+		log: log,
+	}
+}
+
+// implements executor.Executor
+func (ex *Executor) Execute(j *job.Job, rm job.Remover) error {
+	_, err := ex.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+// implements executor.ContextExecutor, jobs which are already running
+// aren't cancelled when ctx is done
+func (ex *Executor) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	t, err := ParseTrigger(j)
+	if err != nil {
+		return nil, err
+	}
+
+	runner, ok := rm.(Runner)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	parent := &job.Parent{
+		ID:   j.ID,
+		Time: j.State.Time,
+	}
+
+	var triggered []string
+	result := func() *job.Result {
+		return &job.Result{
+			Output: strings.Join(triggered, "\n"),
+		}
+	}
+
+	for _, id := range t.Jobs {
+		done, err := runner.Trigger(id, parent)
+		if err != nil {
+			return result(), &Error{id, err}
+		}
+		triggered = append(triggered, string(id))
+
+		ex.log.Info("job triggered", zap.String("job_id", string(j.ID)), zap.String("triggered", string(id)))
+
+		if !t.Wait {
+			continue
+		}
+
+		select {
+		case err := <-done:
+			if err != nil {
+				return result(), &Error{id, err}
+			}
+		case <-ctx.Done():
+			return result(), ctx.Err()
+		}
+	}
+	return result(), nil
+}
+
+// implements executor.Validator
+func (ex *Executor) Validate(j *job.Job) error {
+	_, err := ParseTrigger(j)
+	return err
+}
+
+// ParseTrigger decodes and validates the trigger stored in a job's
+// payload.
+func ParseTrigger(j *job.Job) (*Trigger, error) {
+	var t Trigger
+	if err := json.Unmarshal(j.Payload, &t); err != nil {
+		return nil, err
+	}
+
+	if len(t.Jobs) == 0 {
+		return nil, ErrMissingJobs
+	}
+	for _, id := range t.Jobs {
+		if id == j.ID {
+			return nil, ErrSelfTrigger
+		}
+	}
+	return &t, nil
+}
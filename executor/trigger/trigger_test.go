@@ -0,0 +1,106 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/mewa/djinn/djinn/job"
+	"go.uber.org/zap"
+	"reflect"
+	"testing"
+)
+
+type testRunner struct {
+	// errors of executions of jobs
+	errors map[job.ID]error
+
+	triggered []job.ID
+	parents   []*job.Parent
+}
+
+func (r *testRunner) Remove(j *job.Job) error {
+	return nil
+}
+
+func (r *testRunner) Trigger(id job.ID, parent *job.Parent) (<-chan error, error) {
+	r.triggered = append(r.triggered, id)
+	r.parents = append(r.parents, parent)
+
+	done := make(chan error, 1)
+	done <- r.errors[id]
+	return done, nil
+}
+
+func newJob(t *testing.T, tr Trigger) *job.Job {
+	payload, err := json.Marshal(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &job.Job{
+		ID:      "nightly",
+		State:   job.State{State: job.Starting, Time: 1552953600},
+		Payload: payload,
+	}
+}
+
+func Test_ExecuteContext(t *testing.T) {
+	r := &testRunner{}
+	j := newJob(t, Trigger{Jobs: []job.ID{"export", "compress"}})
+
+	res, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.triggered) != 2 || r.triggered[0] != "export" || r.triggered[1] != "compress" {
+		t.Fatalf("invalid triggered jobs: expected='[export compress]', actual='%v'", r.triggered)
+	}
+	expected := job.Parent{ID: "nightly", Time: 1552953600}
+	if !reflect.DeepEqual(*r.parents[0], expected) {
+		t.Fatalf("invalid parent: expected='%v', actual='%v'", expected, *r.parents[0])
+	}
+	if res.Output != "export\ncompress" {
+		t.Fatalf("invalid output: expected='export\\ncompress', actual='%s'", res.Output)
+	}
+}
+
+func Test_ExecuteContext_Wait(t *testing.T) {
+	failure := errors.New("failure")
+	r := &testRunner{
+		errors: map[job.ID]error{"compress": failure},
+	}
+	j := newJob(t, Trigger{Jobs: []job.ID{"export", "compress", "upload"}, Wait: true})
+
+	_, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, r)
+
+	triggerErr, ok := err.(*Error)
+	if !ok || triggerErr.Job != "compress" || triggerErr.Err != failure {
+		t.Fatalf("invalid error: expected failure of 'compress', actual='%v'", err)
+	}
+	if len(r.triggered) != 2 {
+		t.Fatalf("pipeline not stopped: triggered='%v'", r.triggered)
+	}
+}
+
+func Test_ExecuteContext_Unsupported(t *testing.T) {
+	j := newJob(t, Trigger{Jobs: []job.ID{"export"}})
+
+	_, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err != ErrUnsupported {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrUnsupported, err)
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	ex := New(zap.NewNop())
+
+	err := ex.Validate(newJob(t, Trigger{}))
+	if err != ErrMissingJobs {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrMissingJobs, err)
+	}
+
+	err = ex.Validate(newJob(t, Trigger{Jobs: []job.ID{"nightly"}}))
+	if err != ErrSelfTrigger {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrSelfTrigger, err)
+	}
+}
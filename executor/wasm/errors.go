@@ -0,0 +1,12 @@
+package wasm
+
+import (
+	"errors"
+)
+
+var (
+	ErrMissingModule   = errors.New("missing module path or binary")
+	ErrAmbiguousModule = errors.New("module path and binary are mutually exclusive")
+	ErrInvalidMemory   = errors.New("memory must be at least one 64KiB page")
+	ErrInvalidTimeout  = errors.New("timeout must be positive")
+)
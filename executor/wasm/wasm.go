@@ -0,0 +1,223 @@
+// Package wasm runs jobs as WebAssembly modules using WASI, without
+// leaving djinn's process.
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor"
+	"github.com/mewa/djinn/executor/exec"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const (
+	// size of a WebAssembly memory page
+	pageSize = 64 * 1024
+	maxPages = 65536
+)
+
+// Module describes the module run on every run of a job. It is decoded
+// from the job's payload, which the module reads from its stdin, with
+// the job's id in DJINN_JOB_ID.
+type Module struct {
+	// the module is read either from a file or from the payload itself,
+	// base64 encoded
+	Path   string `json:"path"`
+	Binary []byte `json:"binary"`
+
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+
+	// can only lower the limits of the executor, zero values mean no
+	// change
+	Memory uint64 `json:"memory"`
+	// parsed with time.ParseDuration, e.g. "30s"
+	Timeout string `json:"timeout"`
+}
+
+type Executor struct {
+	// bytes of linear memory available to a module, rounded down to
+	// whole pages but at least one, zero means no limit
+	Memory uint64
+
+	// wall time a module can run for, zero means no limit
+	Timeout time.Duration
+
+	// maximum number of bytes captured from each of stdout and stderr
+	MaxOutput int
+
+	// shared by runtimes of all executions, so that modules are only
+	// compiled once
+	cache wazero.CompilationCache
+
+	log *zap.Logger
+}
+
+func New(log *zap.Logger) *Executor {
+	return &Executor{
+		Memory:    64 * 1024 * 1024,
+		Timeout:   time.Minute,
+		MaxOutput: 64 * 1024,
+		cache:     wazero.NewCompilationCache(),
+		log:       log,
+	}
+}
+
+// implements executor.Executor
+func (ex *Executor) Execute(j *job.Job, rm job.Remover) error {
+	_, err := ex.ExecuteContext(context.Background(), j, rm)
+	return err
+}
+
+// implements executor.ContextExecutor, the module is stopped when ctx is
+// done
+func (ex *Executor) ExecuteContext(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+	m, timeout, err := ex.module(j)
+	if err != nil {
+		return nil, err
+	}
+
+	binary := m.Binary
+	if m.Path != "" {
+		binary, err = ioutil.ReadFile(m.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	memory := ex.Memory
+	if m.Memory != 0 && (memory == 0 || m.Memory < memory) {
+		memory = m.Memory
+	}
+
+	// wasm32 memories can't grow past 4GiB anyway
+	pages := uint32(maxPages)
+	if memory != 0 && memory/pageSize < maxPages {
+		pages = uint32(memory / pageSize)
+	}
+	if pages == 0 {
+		pages = 1
+	}
+
+	parent := ctx
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCompilationCache(ex.cache).
+		WithMemoryLimitPages(pages).
+		WithCloseOnContextDone(true))
+	defer rt.Close(context.Background())
+
+	wasi_snapshot_preview1.MustInstantiate(ctx, rt)
+
+	compiled, err := rt.CompileModule(ctx, binary)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout := &exec.LimitedBuffer{Limit: ex.MaxOutput}
+	stderr := &exec.LimitedBuffer{Limit: ex.MaxOutput}
+
+	config := wazero.NewModuleConfig().
+		WithName(string(j.ID)).
+		WithArgs(append([]string{string(j.ID)}, m.Args...)...).
+		WithStdin(bytes.NewReader(j.Payload)).
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep().
+		WithEnv("DJINN_JOB_ID", string(j.ID))
+
+	for _, env := range m.Env {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) == 2 {
+			config = config.WithEnv(kv[0], kv[1])
+		}
+	}
+
+	start := time.Now()
+	_, err = rt.InstantiateModule(ctx, compiled, config)
+
+	ex.log.Info("module finished",
+		zap.String("job_id", string(j.ID)),
+		zap.Duration("duration", time.Now().Sub(start)),
+		zap.ByteString("stdout", stdout.Bytes()),
+		zap.ByteString("stderr", stderr.Bytes()),
+		zap.Error(err))
+
+	res := &job.Result{
+		Output: stdout.String(),
+	}
+
+	if exitErr, ok := err.(*sys.ExitError); ok {
+		switch exitErr.ExitCode() {
+		case 0:
+			return res, nil
+		case sys.ExitCodeDeadlineExceeded, sys.ExitCodeContextCanceled:
+			if parent.Err() != nil {
+				return res, parent.Err()
+			}
+			return res, executor.ErrTimeout
+		}
+
+		res.ExitCode = int(exitErr.ExitCode())
+		return res, &exec.ExitError{
+			ExitCode: res.ExitCode,
+			Stderr:   stderr.String(),
+		}
+	}
+	return res, err
+}
+
+// implements executor.Validator
+func (ex *Executor) Validate(j *job.Job) error {
+	_, _, err := ex.module(j)
+	return err
+}
+
+func (ex *Executor) module(j *job.Job) (*Module, time.Duration, error) {
+	var m Module
+	if err := json.Unmarshal(j.Payload, &m); err != nil {
+		return nil, 0, err
+	}
+
+	if m.Path == "" && len(m.Binary) == 0 {
+		return nil, 0, ErrMissingModule
+	}
+	if m.Path != "" && len(m.Binary) != 0 {
+		return nil, 0, ErrAmbiguousModule
+	}
+	if m.Memory != 0 && m.Memory < pageSize {
+		return nil, 0, ErrInvalidMemory
+	}
+
+	timeout := ex.Timeout
+	if m.Timeout != "" {
+		t, err := time.ParseDuration(m.Timeout)
+		if err != nil {
+			return nil, 0, err
+		}
+		if t <= 0 {
+			return nil, 0, ErrInvalidTimeout
+		}
+		if timeout == 0 || t < timeout {
+			timeout = t
+		}
+	}
+	return &m, timeout, nil
+}
@@ -0,0 +1,129 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor"
+	"github.com/mewa/djinn/executor/exec"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"testing"
+)
+
+func newJob(t *testing.T, m Module) *job.Job {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &job.Job{
+		ID:      "test-wasm-job",
+		Payload: payload,
+	}
+}
+
+func Test_ExecuteContext_Stdin(t *testing.T) {
+	j := newJob(t, Module{Path: "testdata/echo.wasm"})
+
+	res, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Output != string(j.Payload) {
+		t.Fatalf("invalid output: expected='%s', actual='%s'", j.Payload, res.Output)
+	}
+}
+
+func Test_ExecuteContext_Binary(t *testing.T) {
+	binary, err := ioutil.ReadFile("testdata/echo.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := newJob(t, Module{Binary: binary})
+
+	res, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Output != string(j.Payload) {
+		t.Fatalf("invalid output: expected='%s', actual='%s'", j.Payload, res.Output)
+	}
+}
+
+func Test_ExecuteContext_ExitCode(t *testing.T) {
+	j := newJob(t, Module{Path: "testdata/exit.wasm"})
+
+	res, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode != 3 {
+		t.Fatalf("invalid error: expected exit code 3, actual='%v'", err)
+	}
+	if res.ExitCode != 3 {
+		t.Fatalf("invalid exit code: expected='3', actual='%d'", res.ExitCode)
+	}
+}
+
+func Test_ExecuteContext_Timeout(t *testing.T) {
+	j := newJob(t, Module{
+		Path:    "testdata/loop.wasm",
+		Timeout: "50ms",
+	})
+
+	_, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err != executor.ErrTimeout {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", executor.ErrTimeout, err)
+	}
+}
+
+func Test_ExecuteContext_Cancel(t *testing.T) {
+	j := newJob(t, Module{Path: "testdata/loop.wasm"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := New(zap.NewNop()).ExecuteContext(ctx, j, nil)
+	if err != context.Canceled {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", context.Canceled, err)
+	}
+}
+
+func Test_ExecuteContext_Memory(t *testing.T) {
+	// the module requires 16 pages
+	j := newJob(t, Module{
+		Path:   "testdata/memory.wasm",
+		Memory: 8 * pageSize,
+	})
+
+	_, err := New(zap.NewNop()).ExecuteContext(context.Background(), j, nil)
+	if err == nil {
+		t.Fatalf("memory limit not enforced")
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	ex := New(zap.NewNop())
+
+	err := ex.Validate(newJob(t, Module{}))
+	if err != ErrMissingModule {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrMissingModule, err)
+	}
+
+	err = ex.Validate(newJob(t, Module{Path: "a.wasm", Binary: []byte{0}}))
+	if err != ErrAmbiguousModule {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrAmbiguousModule, err)
+	}
+
+	err = ex.Validate(newJob(t, Module{Path: "a.wasm", Memory: pageSize - 1}))
+	if err != ErrInvalidMemory {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrInvalidMemory, err)
+	}
+
+	for _, timeout := range []string{"0s", "-1s"} {
+		err = ex.Validate(newJob(t, Module{Path: "a.wasm", Timeout: timeout}))
+		if err != ErrInvalidTimeout {
+			t.Fatalf("invalid error for '%s': expected='%v', actual='%v'", timeout, ErrInvalidTimeout, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package schedule
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// IntervalSchedule runs every Interval, at Anchor shifted by Phase and
+// every multiple of Interval before and after it. Without an anchor
+// executions are aligned to the Unix epoch, so every node computes the
+// same times.
+type IntervalSchedule struct {
+	Interval string `json:"interval"`
+	Anchor   int64  `json:"anchor,omitempty"`
+	Phase    string `json:"phase,omitempty"`
+
+	interval time.Duration
+	anchor   time.Time
+	phase    time.Duration
+}
+
+func Interval(d time.Duration, anchor time.Time, phase time.Duration) *IntervalSchedule {
+	return &IntervalSchedule{
+		interval: d,
+		anchor:   anchor,
+		phase:    phase,
+	}
+}
+
+func (is *IntervalSchedule) Next(t time.Time) time.Time {
+	anchor := is.anchor
+	if anchor.IsZero() {
+		anchor = time.Unix(0, 0)
+	}
+	base := anchor.Add(is.phase)
+
+	// number of whole intervals from base to t, rounded down also for
+	// times before base
+	d := t.Sub(base)
+	n := d / is.interval
+	if d < 0 && d%is.interval != 0 {
+		n--
+	}
+	return base.Add((n + 1) * is.interval)
+}
+
+func (is *IntervalSchedule) Serialize() string {
+	is.Interval = is.interval.String()
+	is.Anchor = 0
+	if !is.anchor.IsZero() {
+		is.Anchor = is.anchor.Unix()
+	}
+	is.Phase = ""
+	if is.phase != 0 {
+		is.Phase = is.phase.String()
+	}
+
+	d, _ := json.Marshal(is)
+	return string(d)
+}
+
+func (is *IntervalSchedule) Deserialize(spec string) error {
+	var sched IntervalSchedule
+	if err := json.Unmarshal([]byte(spec), &sched); err != nil {
+		return err
+	}
+
+	interval, err := time.ParseDuration(sched.Interval)
+	if err != nil {
+		return err
+	}
+	if interval < time.Second {
+		return ErrInvalidInterval
+	}
+
+	var phase time.Duration
+	if sched.Phase != "" {
+		if phase, err = time.ParseDuration(sched.Phase); err != nil {
+			return err
+		}
+	}
+	if phase < 0 || phase >= interval {
+		return ErrInvalidPhase
+	}
+
+	is.Interval = sched.Interval
+	is.Anchor = sched.Anchor
+	is.Phase = sched.Phase
+
+	is.interval = interval
+	is.anchor = time.Unix(sched.Anchor, 0)
+	is.phase = phase
+
+	return nil
+}
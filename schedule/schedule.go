@@ -28,6 +28,7 @@ type SerializableSchedule interface {
 const (
 	TypeOnce SchedType = iota
 	TypeSpec
+	TypeInterval
 )
 
 type JSONSchedule struct {
@@ -43,10 +44,15 @@ func (js JSONSchedule) Schedule() (SerializableSchedule, error) {
 	case TypeSpec:
 		sched := new(SpecSchedule)
 		return sched, sched.Deserialize(js.ScheduleData)
+	case TypeInterval:
+		sched := new(IntervalSchedule)
+		return sched, sched.Deserialize(js.ScheduleData)
 	}
 	return nil, ErrUnknownScheduleType
 }
 
 var (
 	ErrUnknownScheduleType = errors.New("unknown schedule type")
+	ErrInvalidInterval     = errors.New("interval has to be at least a second")
+	ErrInvalidPhase        = errors.New("phase has to be within the interval")
 )
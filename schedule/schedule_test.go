@@ -21,3 +21,66 @@ func Test_Schedule_Serialize_Once(t *testing.T) {
 		t.Fatalf("failed to deserialize schedule: expected='%s', actual='%s'", now, once.Time)
 	}
 }
+
+func Test_Schedule_Serialize_Interval(t *testing.T) {
+	anchor := time.Unix(1000, 0)
+
+	sched := JSONSchedule{TypeInterval, Interval(90*time.Second, anchor, 30*time.Second).Serialize()}
+
+	s, err := sched.Schedule()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interval := s.(*IntervalSchedule)
+	if interval.interval != 90*time.Second || interval.anchor != anchor || interval.phase != 30*time.Second {
+		t.Fatalf("failed to deserialize schedule: %+v", interval)
+	}
+}
+
+func Test_IntervalSchedule_Next(t *testing.T) {
+	sched := Interval(90*time.Second, time.Unix(1000, 0), 30*time.Second)
+
+	cases := []struct {
+		t    int64
+		next int64
+	}{
+		// multiples of the interval before the anchor shifted by the
+		// phase
+		{0, 40},
+		{939, 940},
+		{940, 1030},
+		{1029, 1030},
+		{1030, 1120},
+		{1100, 1120},
+		{1000000, 1000030},
+	}
+	for _, c := range cases {
+		next := sched.Next(time.Unix(c.t, 0))
+		if next.Unix() != c.next {
+			t.Fatalf("invalid next execution after '%d': expected='%d', actual='%d'", c.t, c.next, next.Unix())
+		}
+	}
+
+	// aligned to the epoch without an anchor
+	sched = Interval(36*time.Hour, time.Time{}, 0)
+	if next := sched.Next(time.Unix(100, 0)); next.Unix() != 36*3600 {
+		t.Fatalf("invalid next execution: expected='%d', actual='%d'", 36*3600, next.Unix())
+	}
+}
+
+func Test_IntervalSchedule_Invalid(t *testing.T) {
+	cases := map[string]error{
+		`{"interval": "500ms"}`:                ErrInvalidInterval,
+		`{"interval": "1m", "phase": "1m"}`:    ErrInvalidPhase,
+		`{"interval": "1m", "phase": "-1s"}`:   ErrInvalidPhase,
+		`{"interval": "1m", "phase": "59s"}`:   nil,
+		`{"interval": "36h", "anchor": 86400}`: nil,
+	}
+	for spec, expected := range cases {
+		_, err := JSONSchedule{TypeInterval, spec}.Schedule()
+		if err != expected {
+			t.Fatalf("invalid error for '%s': expected='%v', actual='%v'", spec, expected, err)
+		}
+	}
+}
@@ -0,0 +1,458 @@
+// Package buffered saves job states and results asynchronously, fanning
+// them out to several storages without holding up executions.
+package buffered
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/storage"
+	"github.com/mewa/djinn/utils"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Backend is one of the storages states are written to.
+type Backend struct {
+	// names the backend's spill file, so it has to be unique and stable
+	// across restarts
+	Name    string
+	Storage storage.Storage
+}
+
+// Writer queues saved states and writes them to each of its backends in
+// the background, retrying failed writes. States which can't be written
+// or queued are spilled to a file per backend and written once the
+// backend recovers, spilled states may be written out of order. Results
+// are written the same way to backends implementing
+// storage.ResultStorage, while reads go to a single primary backend.
+type Writer struct {
+	// name of the backend states are read from, the first one
+	// implementing storage.Reader if empty
+	Primary string
+
+	// number of states queued per backend
+	QueueSize int
+
+	// failed writes are retried with a backoff starting at RetryMin
+	// for as long as RetryTimeout, before they're spilled
+	RetryMin     time.Duration
+	RetryTimeout time.Duration
+
+	// how often spilled states are retried
+	RecoverInterval time.Duration
+
+	dir      string
+	backends []*backend
+
+	stop chan struct{}
+	wg   *sync.WaitGroup
+
+	log *zap.Logger
+}
+
+type backend struct {
+	Backend
+
+	queue chan entry
+
+	// spilled states are kept in order in the spill file
+	spill   string
+	spilled int
+	mu      *sync.Mutex
+}
+
+// entry is a queued or spilled state, or a result if Result is set
+type entry struct {
+	storage.Record
+	Result *job.Result `json:"result,omitempty"`
+}
+
+// New returns a writer spilling states to dir, it has to be started
+// before it's used.
+func New(dir string, log *zap.Logger, backends ...Backend) *Writer {
+	w := &Writer{
+		QueueSize:       1024,
+		RetryMin:        100 * time.Millisecond,
+		RetryTimeout:    5 * time.Second,
+		RecoverInterval: 10 * time.Second,
+
+		dir:  dir,
+		stop: make(chan struct{}),
+		wg:   new(sync.WaitGroup),
+		log:  log,
+	}
+
+	for _, b := range backends {
+		w.backends = append(w.backends, &backend{
+			Backend: b,
+			spill:   filepath.Join(dir, b.Name+".spill"),
+			mu:      new(sync.Mutex),
+		})
+	}
+	return w
+}
+
+// Start starts writing to backends, beginning with states spilled
+// before the last shutdown.
+func (w *Writer) Start() error {
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return err
+	}
+
+	for _, b := range w.backends {
+		n, err := countSpilled(b.spill)
+		if err != nil {
+			return err
+		}
+		b.spilled = n
+		b.queue = make(chan entry, w.QueueSize)
+	}
+
+	for _, b := range w.backends {
+		w.wg.Add(1)
+		go w.run(b)
+	}
+	return nil
+}
+
+// Close stops the writer, writing queued states to their backends once
+// more and spilling the ones which fail.
+func (w *Writer) Close() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+// implements storage.Storage, the state is only queued, an error is
+// returned if it could neither be queued nor spilled
+func (w *Writer) SaveJobState(id job.ID, state job.State) error {
+	e := entry{
+		Record: storage.Record{
+			Job:   id,
+			State: state,
+		},
+	}
+	return w.enqueue(w.backends, e)
+}
+
+// implements storage.ResultStorage, the result is queued for backends
+// implementing it just like states are
+func (w *Writer) SaveJobResult(id job.ID, result job.Result) error {
+	var backends []*backend
+	for _, b := range w.backends {
+		if _, ok := b.Storage.(storage.ResultStorage); ok {
+			backends = append(backends, b)
+		}
+	}
+
+	e := entry{
+		Record: storage.Record{
+			Job: id,
+		},
+		Result: &result,
+	}
+	return w.enqueue(backends, e)
+}
+
+func (w *Writer) enqueue(backends []*backend, e entry) error {
+	var err error
+	for _, b := range backends {
+		select {
+		case b.queue <- e:
+		default:
+			w.log.Warn("storage queue full, spilling state", zap.String("backend", b.Name), zap.String("job_id", string(e.Job)))
+			if serr := b.spillEntry(e); serr != nil {
+				err = serr
+			}
+		}
+	}
+	return err
+}
+
+// implements storage.Binder, binding every backend which supports it
+// under its own prefix
+func (w *Writer) Bind(kv storage.KV, prefix string) {
+	for _, b := range w.backends {
+		if binder, ok := b.Storage.(storage.Binder); ok {
+			binder.Bind(kv, prefix+b.Name+"/")
+		}
+	}
+}
+
+// implements storage.SharedStorage, the writer is shared if any of its
+// backends is
+func (w *Writer) Shared() bool {
+	for _, b := range w.backends {
+		if shared, ok := b.Storage.(storage.SharedStorage); ok && shared.Shared() {
+			return true
+		}
+	}
+	return false
+}
+
+// primary returns the backend states are read from
+func (w *Writer) primary() (storage.Reader, error) {
+	for _, b := range w.backends {
+		if w.Primary != "" && b.Name != w.Primary {
+			continue
+		}
+		if r, ok := b.Storage.(storage.Reader); ok {
+			return r, nil
+		}
+		if w.Primary != "" {
+			break
+		}
+	}
+	return nil, storage.ErrReadUnsupported
+}
+
+// implements storage.Reader, reading from the primary backend. States
+// still queued or spilled aren't listed.
+func (w *Writer) LatestState(id job.ID) (*storage.Record, error) {
+	r, err := w.primary()
+	if err != nil {
+		return nil, err
+	}
+	return r.LatestState(id)
+}
+
+// implements storage.Reader
+func (w *Writer) History(id job.ID, from, to time.Time, limit int, cursor string) ([]storage.Record, string, error) {
+	r, err := w.primary()
+	if err != nil {
+		return nil, "", err
+	}
+	return r.History(id, from, to, limit, cursor)
+}
+
+// implements storage.Reader
+func (w *Writer) ListFailures(since time.Time, limit int) ([]storage.Record, error) {
+	r, err := w.primary()
+	if err != nil {
+		return nil, err
+	}
+	return r.ListFailures(since, limit)
+}
+
+// implements storage.Pruner, pruning every backend which supports it.
+// The number of states removed from all of them is returned, together
+// with the executions removed from each of them.
+func (w *Writer) Prune(policy storage.RetentionPolicy, now time.Time, dryRun bool) (storage.Pruned, error) {
+	var pruned storage.Pruned
+	var err error
+
+	removed := map[storage.Execution]int{}
+	var pruners int
+	for _, b := range w.backends {
+		p, ok := b.Storage.(storage.Pruner)
+		if !ok {
+			continue
+		}
+		pruners++
+
+		bp, perr := p.Prune(policy, now, dryRun)
+		if perr != nil {
+			w.log.Error("error pruning job states", zap.String("backend", b.Name), zap.Error(perr))
+			err = perr
+		}
+		pruned.States += bp.States
+		for _, e := range bp.Executions {
+			removed[e]++
+		}
+	}
+
+	for e, n := range removed {
+		if n == pruners {
+			pruned.Executions = append(pruned.Executions, e)
+		}
+	}
+	return pruned, err
+}
+
+func (w *Writer) run(b *backend) {
+	defer w.wg.Done()
+
+	recovery := time.NewTicker(w.RecoverInterval)
+	defer recovery.Stop()
+
+	for {
+		select {
+		case e := <-b.queue:
+			w.write(b, e, true)
+		case <-recovery.C:
+			w.recoverSpilled(b)
+		case <-w.stop:
+			// flush what's been queued so far
+			for {
+				select {
+				case e := <-b.queue:
+					w.write(b, e, false)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write saves the entry, spilling it if that fails or if earlier ones
+// are still spilled
+func (w *Writer) write(b *backend, e entry, retry bool) {
+	b.mu.Lock()
+	spilled := b.spilled
+	b.mu.Unlock()
+
+	var err error
+	if spilled == 0 {
+		save := func() error {
+			return b.save(e)
+		}
+
+		if retry {
+			err = utils.Backoff(w.RetryMin, w.RetryTimeout, save)
+		} else {
+			err = save()
+		}
+		if err == nil {
+			return
+		}
+		w.log.Error("error saving job state, spilling it", zap.String("backend", b.Name), zap.String("job_id", string(e.Job)), zap.Error(err))
+	}
+
+	if err := b.spillEntry(e); err != nil {
+		w.log.Error("could not spill job state, dropping it", zap.String("backend", b.Name), zap.String("job_id", string(e.Job)), zap.Error(err))
+	}
+}
+
+// recoverSpilled writes spilled states to the backend, keeping the ones
+// which fail spilled
+func (w *Writer) recoverSpilled(b *backend) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.spilled == 0 {
+		return
+	}
+
+	entries, err := readSpilled(b.spill)
+	if err != nil {
+		w.log.Error("could not read spilled states", zap.String("backend", b.Name), zap.Error(err))
+		return
+	}
+
+	var written int
+	for _, e := range entries {
+		if err := b.save(e); err != nil {
+			break
+		}
+		written++
+	}
+
+	if written == len(entries) {
+		err = os.Remove(b.spill)
+	} else {
+		err = writeSpilled(b.spill, entries[written:])
+	}
+	if err != nil {
+		w.log.Error("could not update spilled states", zap.String("backend", b.Name), zap.Error(err))
+		return
+	}
+
+	b.spilled = len(entries) - written
+	w.log.Info("recovered spilled states", zap.String("backend", b.Name), zap.Int("written", written), zap.Int("spilled", b.spilled))
+}
+
+// save writes the entry to the backend
+func (b *backend) save(e entry) error {
+	if e.Result == nil {
+		return b.Storage.SaveJobState(e.Job, e.State)
+	}
+	return b.Storage.(storage.ResultStorage).SaveJobResult(e.Job, *e.Result)
+}
+
+func (b *backend) spillEntry(e entry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(b.spill, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(line, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	b.spilled++
+	return nil
+}
+
+func readSpilled(path string) ([]entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// a write cut short by a crash
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// writeSpilled replaces the spill file with entries
+func writeSpilled(path string, entries []entry) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func countSpilled(path string) (int, error) {
+	entries, err := readSpilled(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return len(entries), err
+}
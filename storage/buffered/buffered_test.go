@@ -0,0 +1,315 @@
+package buffered
+
+import (
+	"context"
+	"errors"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/storage"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("backend down")
+
+type testStorage struct {
+	down   bool
+	states []job.State
+	mu     sync.Mutex
+}
+
+func (s *testStorage) SaveJobState(id job.ID, state job.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.down {
+		return errDown
+	}
+	s.states = append(s.states, state)
+	return nil
+}
+
+func (s *testStorage) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.down = down
+}
+
+func (s *testStorage) times() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var times []int64
+	for _, st := range s.states {
+		times = append(times, st.Time)
+	}
+	return times
+}
+
+func newWriter(t *testing.T, dir string, backends ...Backend) *Writer {
+	w := New(dir, zap.NewNop(), backends...)
+	w.RetryMin = time.Millisecond
+	w.RetryTimeout = 5 * time.Millisecond
+	w.RecoverInterval = 10 * time.Millisecond
+
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func waitFor(t *testing.T, s *testStorage, n int) []int64 {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if times := s.times(); len(times) >= n {
+			return times
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("states not written: expected='%d', actual='%v'", n, s.times())
+	return nil
+}
+
+func Test_Writer_FanOut(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "djinn-buffered")
+	defer os.RemoveAll(dir)
+
+	a, b := &testStorage{}, &testStorage{}
+	w := newWriter(t, dir, Backend{"a", a}, Backend{"b", b})
+
+	for i := int64(1); i <= 3; i++ {
+		if err := w.SaveJobState("test-job", job.State{State: job.Started, Time: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	if len(a.times()) != 3 || len(b.times()) != 3 {
+		t.Fatalf("states not fanned out: a=%v, b=%v", a.times(), b.times())
+	}
+}
+
+func Test_Writer_Spill(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "djinn-buffered")
+	defer os.RemoveAll(dir)
+
+	up, down := &testStorage{}, &testStorage{down: true}
+	w := newWriter(t, dir, Backend{"up", up}, Backend{"down", down})
+
+	for i := int64(1); i <= 3; i++ {
+		w.SaveJobState("test-job", job.State{State: job.Started, Time: i})
+	}
+
+	// the failing backend doesn't hold up the other one
+	waitFor(t, up, 3)
+
+	down.setDown(false)
+
+	times := waitFor(t, down, 3)
+	for i, tm := range times {
+		if tm != int64(i+1) {
+			t.Fatalf("invalid order of recovered states: %v", times)
+		}
+	}
+	w.Close()
+}
+
+func Test_Writer_SpillRestart(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "djinn-buffered")
+	defer os.RemoveAll(dir)
+
+	s := &testStorage{down: true}
+	w := newWriter(t, dir, Backend{"test", s})
+	w.SaveJobState("test-job", job.State{State: job.Started, Time: 1})
+	w.Close()
+
+	s.setDown(false)
+
+	w = newWriter(t, dir, Backend{"test", s})
+	defer w.Close()
+
+	waitFor(t, s, 1)
+}
+
+type resultStorage struct {
+	testStorage
+	results []job.Result
+}
+
+func (s *resultStorage) SaveJobResult(id job.ID, result job.Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.down {
+		return errDown
+	}
+	s.results = append(s.results, result)
+	return nil
+}
+
+func (s *resultStorage) resultCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.results)
+}
+
+type readerStorage struct {
+	testStorage
+	prefix string
+}
+
+func (s *readerStorage) Bind(kv storage.KV, prefix string) {
+	s.prefix = prefix
+}
+
+func (s *readerStorage) LatestState(id job.ID) (*storage.Record, error) {
+	return &storage.Record{Job: id, Node: s.prefix}, nil
+}
+
+func (s *readerStorage) History(id job.ID, from, to time.Time, limit int, cursor string) ([]storage.Record, string, error) {
+	return nil, s.prefix, nil
+}
+
+func (s *readerStorage) ListFailures(since time.Time, limit int) ([]storage.Record, error) {
+	return nil, nil
+}
+
+type nopKV struct{}
+
+func (nopKV) Put(ctx context.Context, key, value []byte) error { return nil }
+
+func (nopKV) Range(ctx context.Context, key, end []byte) ([]storage.KeyValue, error) {
+	return nil, nil
+}
+
+func (nopKV) DeleteRange(ctx context.Context, key, end []byte) error { return nil }
+
+func Test_Writer_SaveJobResult(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "djinn-buffered")
+	defer os.RemoveAll(dir)
+
+	results, states := &resultStorage{testStorage: testStorage{down: true}}, &testStorage{}
+	w := newWriter(t, dir, Backend{"results", results}, Backend{"states", states})
+
+	if err := w.SaveJobResult("test-job", job.Result{Outcome: job.OutcomeSuccess}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the result is spilled and recovered like states are
+	time.Sleep(20 * time.Millisecond)
+	results.setDown(false)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for results.resultCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	w.Close()
+
+	if n := results.resultCount(); n != 1 {
+		t.Fatalf("invalid number of results: expected='1', actual='%d'", n)
+	}
+	if len(results.times()) != 0 || len(states.times()) != 0 {
+		t.Fatalf("result saved as state: results=%v, states=%v", results.times(), states.times())
+	}
+}
+
+func Test_Writer_Bind(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "djinn-buffered")
+	defer os.RemoveAll(dir)
+
+	a, b := &readerStorage{}, &readerStorage{}
+	w := New(dir, zap.NewNop(), Backend{"a", a}, Backend{"plain", &testStorage{}}, Backend{"b", b})
+	w.Bind(nopKV{}, "prefix/")
+
+	if a.prefix != "prefix/a/" || b.prefix != "prefix/b/" {
+		t.Fatalf("invalid prefixes: a='%s', b='%s'", a.prefix, b.prefix)
+	}
+}
+
+type sharedStorage struct {
+	testStorage
+}
+
+func (s *sharedStorage) Shared() bool {
+	return true
+}
+
+func Test_Writer_Shared(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "djinn-buffered")
+	defer os.RemoveAll(dir)
+
+	w := New(dir, zap.NewNop(), Backend{"a", &readerStorage{}}, Backend{"plain", &testStorage{}})
+	if w.Shared() {
+		t.Fatalf("writer without shared backends is shared")
+	}
+
+	w = New(dir, zap.NewNop(), Backend{"plain", &testStorage{}}, Backend{"shared", &sharedStorage{}})
+	if !w.Shared() {
+		t.Fatalf("writer with a shared backend isn't shared")
+	}
+}
+
+func Test_Writer_Reader(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "djinn-buffered")
+	defer os.RemoveAll(dir)
+
+	a, b := &readerStorage{prefix: "a"}, &readerStorage{prefix: "b"}
+	w := New(dir, zap.NewNop(), Backend{"plain", &testStorage{}}, Backend{"a", a}, Backend{"b", b})
+
+	// the first reader by default
+	if r, err := w.LatestState("test-job"); err != nil || r.Node != "a" {
+		t.Fatalf("invalid primary: expected='a', actual='%v' (%v)", r, err)
+	}
+
+	w.Primary = "b"
+	if _, cursor, err := w.History("test-job", time.Time{}, time.Time{}, 1, ""); err != nil || cursor != "b" {
+		t.Fatalf("invalid primary: expected='b', actual='%s' (%v)", cursor, err)
+	}
+
+	w.Primary = "plain"
+	if _, err := w.ListFailures(time.Time{}, 1); err != storage.ErrReadUnsupported {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", storage.ErrReadUnsupported, err)
+	}
+}
+
+type prunerStorage struct {
+	testStorage
+	pruned storage.Pruned
+}
+
+func (s *prunerStorage) Prune(policy storage.RetentionPolicy, now time.Time, dryRun bool) (storage.Pruned, error) {
+	return s.pruned, nil
+}
+
+func Test_Writer_Prune(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "djinn-buffered")
+	defer os.RemoveAll(dir)
+
+	a := &prunerStorage{pruned: storage.Pruned{
+		States:     3,
+		Executions: []storage.Execution{{Job: "a", Time: 1}, {Job: "a", Time: 2}},
+	}}
+	b := &prunerStorage{pruned: storage.Pruned{
+		States:     1,
+		Executions: []storage.Execution{{Job: "a", Time: 1}},
+	}}
+	w := New(dir, zap.NewNop(), Backend{"a", a}, Backend{"plain", &testStorage{}}, Backend{"b", b})
+
+	pruned, err := w.Prune(storage.RetentionPolicy{}, time.Now(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned.States != 4 {
+		t.Fatalf("invalid number of pruned states: expected='4', actual='%d'", pruned.States)
+	}
+
+	// only executions gone from every backend are reported
+	if len(pruned.Executions) != 1 || pruned.Executions[0] != (storage.Execution{Job: "a", Time: 1}) {
+		t.Fatalf("invalid pruned executions: %v", pruned.Executions)
+	}
+}
@@ -0,0 +1,12 @@
+package storage
+
+import (
+	"errors"
+)
+
+var (
+	ErrNotFound      = errors.New("no saved states")
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	ErrReadUnsupported = errors.New("storage doesn't support reading history")
+)
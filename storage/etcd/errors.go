@@ -0,0 +1,9 @@
+package etcd
+
+import (
+	"errors"
+)
+
+var (
+	ErrNotBound = errors.New("storage isn't bound to an etcd server")
+)
@@ -0,0 +1,312 @@
+// Package etcd stores the history of job states in djinn's embedded etcd,
+// replicating it with the rest of the cluster.
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/storage"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Storage keeps a bounded ring of the latest states of every job. It
+// implements storage.Storage, storage.Reader, storage.Binder and
+// storage.SharedStorage, and has to be bound before it's used, which
+// djinn does when it's started.
+//
+// Records falling out of the ring are deleted, their old revisions are
+// dropped by the compaction djinn configures for its etcd.
+type Storage struct {
+	// number of records kept per job
+	Limit int
+
+	// timeout of requests to etcd
+	Timeout time.Duration
+
+	kv     storage.KV
+	prefix string
+	node   string
+
+	mu *sync.RWMutex
+}
+
+// New returns a storage keeping limit records per job, recording states
+// as saved by node.
+func New(node string, limit int) *Storage {
+	return &Storage{
+		Limit:   limit,
+		Timeout: 5 * time.Second,
+		node:    node,
+		mu:      new(sync.RWMutex),
+	}
+}
+
+// implements storage.Binder
+func (s *Storage) Bind(kv storage.KV, prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.kv = kv
+	s.prefix = prefix
+}
+
+// implements storage.SharedStorage, all nodes use the same etcd
+func (s *Storage) Shared() bool {
+	return true
+}
+
+func (s *Storage) bound() (storage.KV, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.kv == nil {
+		return nil, "", ErrNotBound
+	}
+	return s.kv, s.prefix, nil
+}
+
+// jobPrefix returns the prefix of the keys holding states of the job,
+// ids are escaped so that no job's prefix is a prefix of another one's
+func jobPrefix(prefix string, id job.ID) []byte {
+	return []byte(prefix + url.PathEscape(string(id)) + "/")
+}
+
+// rangeEnd returns the end of the range of keys starting with prefix
+func rangeEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	end[len(end)-1]++
+	return end
+}
+
+// implements storage.Storage
+func (s *Storage) SaveJobState(id job.ID, state job.State) error {
+	kv, prefix, err := s.bound()
+	if err != nil {
+		return err
+	}
+
+	val, err := json.Marshal(storage.Record{
+		Job:   id,
+		State: state,
+		Node:  s.node,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	// names of the records order them by the time they were saved at
+	jp := jobPrefix(prefix, id)
+	key := append(append([]byte{}, jp...), fmt.Sprintf("%0*d-%s", timeDigits, time.Now().UnixNano(), s.node)...)
+
+	err = kv.Put(ctx, key, val)
+	if err != nil {
+		return err
+	}
+	return s.trim(ctx, kv, jp)
+}
+
+// trim deletes the oldest records of the job exceeding the limit
+func (s *Storage) trim(ctx context.Context, kv storage.KV, jp []byte) error {
+	if s.Limit <= 0 {
+		return nil
+	}
+
+	kvs, err := kv.Range(ctx, jp, rangeEnd(jp))
+	if err != nil {
+		return err
+	}
+
+	excess := len(kvs) - s.Limit
+	if excess <= 0 {
+		return nil
+	}
+
+	return kv.DeleteRange(ctx, kvs[0].Key, append(append([]byte{}, kvs[excess-1].Key...), 0))
+}
+
+// width of the time in names of records
+const timeDigits = 20
+
+// validCursor checks whether cursor is the name of a record
+func validCursor(cursor string) bool {
+	if len(cursor) <= timeDigits || cursor[timeDigits] != '-' {
+		return false
+	}
+	_, err := strconv.ParseUint(cursor[:timeDigits], 10, 64)
+	return err == nil
+}
+
+type entry struct {
+	key    []byte
+	record storage.Record
+}
+
+// entries returns the records saved under prefix, latest first
+func (s *Storage) entries(prefix []byte, kv storage.KV) ([]entry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	kvs, err := kv.Range(ctx, prefix, rangeEnd(prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]entry, 0, len(kvs))
+	for i := len(kvs) - 1; i >= 0; i-- {
+		var r storage.Record
+		if err := json.Unmarshal(kvs[i].Value, &r); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{kvs[i].Key, r})
+	}
+	return entries, nil
+}
+
+// implements storage.Reader
+func (s *Storage) LatestState(id job.ID) (*storage.Record, error) {
+	kv, prefix, err := s.bound()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.entries(jobPrefix(prefix, id), kv)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return &entries[0].record, nil
+}
+
+// implements storage.Reader, states are listed in the order they were
+// saved in and the cursor is the name of the last listed one
+func (s *Storage) History(id job.ID, from, to time.Time, limit int, cursor string) ([]storage.Record, string, error) {
+	kv, prefix, err := s.bound()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if cursor != "" && !validCursor(cursor) {
+		return nil, "", storage.ErrInvalidCursor
+	}
+
+	jp := jobPrefix(prefix, id)
+	entries, err := s.entries(jp, kv)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var records []storage.Record
+	var last string
+	for _, e := range entries {
+		name := string(e.key[len(jp):])
+		if cursor != "" && name >= cursor {
+			continue
+		}
+		if !from.IsZero() && e.record.State.Time < from.Unix() {
+			continue
+		}
+		if !to.IsZero() && e.record.State.Time >= to.Unix() {
+			continue
+		}
+
+		// there are records left past the listed ones
+		if limit > 0 && len(records) == limit {
+			return records, last, nil
+		}
+		records = append(records, e.record)
+		last = name
+	}
+	return records, "", nil
+}
+
+// implements storage.Reader
+func (s *Storage) ListFailures(since time.Time, limit int) ([]storage.Record, error) {
+	kv, prefix, err := s.bound()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.entries([]byte(prefix), kv)
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []storage.Record
+	for _, e := range entries {
+		if e.record.State.State.Failed() && e.record.State.Time >= since.Unix() {
+			failures = append(failures, e.record)
+		}
+	}
+
+	// entries are ordered by job first
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].State.Time > failures[j].State.Time
+	})
+	if limit > 0 && len(failures) > limit {
+		failures = failures[:limit]
+	}
+	return failures, nil
+}
+
+// implements storage.Pruner
+func (s *Storage) Prune(policy storage.RetentionPolicy, now time.Time, dryRun bool) (storage.Pruned, error) {
+	var pruned storage.Pruned
+
+	kv, prefix, err := s.bound()
+	if err != nil {
+		return pruned, err
+	}
+
+	entries, err := s.entries([]byte(prefix), kv)
+	if err != nil {
+		return pruned, err
+	}
+
+	records := make([]storage.Record, 0, len(entries))
+	for _, e := range entries {
+		records = append(records, e.record)
+	}
+	expired := policy.Expired(records, now)
+
+	// states of every expired execution left to remove
+	left := map[storage.Execution]int{}
+	for _, r := range records {
+		if e := (storage.Execution{Job: r.Job, Time: r.State.Time}); expired[e] {
+			left[e]++
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	for _, e := range entries {
+		execution := storage.Execution{Job: e.record.Job, Time: e.record.State.Time}
+		if !expired[execution] {
+			continue
+		}
+
+		if !dryRun {
+			if err := kv.DeleteRange(ctx, e.key, nil); err != nil {
+				return pruned, err
+			}
+		}
+		pruned.States++
+
+		left[execution]--
+		if left[execution] == 0 {
+			pruned.Executions = append(pruned.Executions, execution)
+		}
+	}
+	return pruned, nil
+}
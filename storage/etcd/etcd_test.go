@@ -0,0 +1,130 @@
+package etcd
+
+import (
+	"fmt"
+	"github.com/coreos/etcd/embed"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/storage"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func freeURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	u, _ := url.Parse("http://" + l.Addr().String())
+	return *u
+}
+
+func startEtcd(t *testing.T) (*embed.Etcd, func()) {
+	dir, err := ioutil.TempDir("", "djinn-etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peer, client := freeURL(t), freeURL(t)
+
+	conf := embed.NewConfig()
+	conf.Dir = dir
+	conf.LPUrls = []url.URL{peer}
+	conf.APUrls = []url.URL{peer}
+	conf.LCUrls = []url.URL{client}
+	conf.ACUrls = []url.URL{client}
+	conf.InitialCluster = fmt.Sprintf("%s=%s", conf.Name, peer.String())
+
+	e, err := embed.StartEtcd(conf)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		e.Close()
+		os.RemoveAll(dir)
+		t.Fatal("etcd not ready")
+	}
+
+	return e, func() {
+		e.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func Test_Storage_Ring(t *testing.T) {
+	e, cleanup := startEtcd(t)
+	defer cleanup()
+
+	s := New("test-node", 3)
+	if err := s.SaveJobState("a", job.State{}); err != ErrNotBound {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrNotBound, err)
+	}
+
+	s.Bind(NewKV(e.Server), "\x00djinn/storage/")
+
+	for i := int64(1); i <= 5; i++ {
+		if err := s.SaveJobState("a", job.State{State: job.Started, Time: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a job whose escaped id shares a prefix with the other one
+	if err := s.SaveJobState("a/b", job.State{State: job.Error, Time: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, cursor, err := s.History("a", time.Time{}, time.Time{}, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || cursor != "" {
+		t.Fatalf("invalid history: records=%v, cursor='%s'", records, cursor)
+	}
+	if records[0].State.Time != 5 || records[2].State.Time != 3 {
+		t.Fatalf("oldest records not trimmed: %v", records)
+	}
+
+	records, cursor, err = s.History("a", time.Time{}, time.Time{}, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || cursor == "" {
+		t.Fatalf("invalid first page: records=%v, cursor='%s'", records, cursor)
+	}
+
+	records, cursor, err = s.History("a", time.Time{}, time.Time{}, 2, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].State.Time != 3 || cursor != "" {
+		t.Fatalf("invalid second page: records=%v, cursor='%s'", records, cursor)
+	}
+
+	latest, err := s.LatestState("a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Job != "a/b" || latest.Node != "test-node" {
+		t.Fatalf("invalid latest state: %v", latest)
+	}
+
+	failures, err := s.ListFailures(time.Unix(0, 0), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Job != "a/b" {
+		t.Fatalf("invalid failures: %v", failures)
+	}
+
+	if _, err := s.LatestState("c"); err != storage.ErrNotFound {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", storage.ErrNotFound, err)
+	}
+}
@@ -0,0 +1,52 @@
+package etcd
+
+import (
+	"context"
+	"github.com/coreos/etcd/etcdserver"
+	pb "github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/mewa/djinn/storage"
+)
+
+// KV exposes an etcd server as a storage.KV to storages bound to it.
+type KV struct {
+	kv etcdserver.RaftKV
+}
+
+func NewKV(kv etcdserver.RaftKV) *KV {
+	return &KV{kv}
+}
+
+// implements storage.KV
+func (kv *KV) Put(ctx context.Context, key, value []byte) error {
+	_, err := kv.kv.Put(ctx, &pb.PutRequest{
+		Key:   key,
+		Value: value,
+	})
+	return err
+}
+
+// implements storage.KV
+func (kv *KV) Range(ctx context.Context, key, end []byte) ([]storage.KeyValue, error) {
+	resp, err := kv.kv.Range(ctx, &pb.RangeRequest{
+		Key:      key,
+		RangeEnd: end,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	kvs := make([]storage.KeyValue, 0, len(resp.Kvs))
+	for _, p := range resp.Kvs {
+		kvs = append(kvs, storage.KeyValue{Key: p.Key, Value: p.Value})
+	}
+	return kvs, nil
+}
+
+// implements storage.KV
+func (kv *KV) DeleteRange(ctx context.Context, key, end []byte) error {
+	_, err := kv.kv.DeleteRange(ctx, &pb.DeleteRangeRequest{
+		Key:      key,
+		RangeEnd: end,
+	})
+	return err
+}
@@ -1,9 +1,76 @@
 package storage
 
 import (
+	"context"
 	"github.com/mewa/djinn/djinn/job"
+	"time"
 )
 
 type Storage interface {
 	SaveJobState(id job.ID, state job.State) error
 }
+
+// ResultStorage is implemented by storages which persist the results of
+// executions next to job states.
+type ResultStorage interface {
+	SaveJobResult(id job.ID, result job.Result) error
+}
+
+// Reader is implemented by storages able to read saved states back.
+type Reader interface {
+	// LatestState returns the most recently saved state of the job, or
+	// ErrNotFound if it has none.
+	LatestState(id job.ID) (*Record, error)
+
+	// History returns up to limit states of the job saved within
+	// [from, to), latest first, zero times leaving the range open. The
+	// returned cursor continues the listing where it stopped, it's empty
+	// once there is nothing left.
+	History(id job.ID, from, to time.Time, limit int, cursor string) ([]Record, string, error)
+
+	// ListFailures returns up to limit states of failed executions
+	// saved since the given time, latest first, a zero limit listing all
+	// of them.
+	ListFailures(since time.Time, limit int) ([]Record, error)
+}
+
+// Binder is implemented by storages which keep their data in djinn's
+// own etcd. Djinn binds them to its server when it's started, their keys
+// have to start with prefix so that djinn doesn't mistake them for jobs.
+type Binder interface {
+	Bind(kv KV, prefix string)
+}
+
+// SharedStorage is implemented by storages which can keep data shared by
+// all nodes, e.g. in djinn's own etcd. Shared reports whether they do,
+// only the leader prunes shared storages.
+type SharedStorage interface {
+	Shared() bool
+}
+
+// KV is the part of djinn's etcd bound storages keep their data in.
+type KV interface {
+	Put(ctx context.Context, key, value []byte) error
+
+	// Range returns the pairs with keys within [key, end), ordered by
+	// key.
+	Range(ctx context.Context, key, end []byte) ([]KeyValue, error)
+
+	// DeleteRange deletes the keys within [key, end), or just key if
+	// end is nil.
+	DeleteRange(ctx context.Context, key, end []byte) error
+}
+
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// Record is a job state saved by a storage.
+type Record struct {
+	Job   job.ID    `json:"job"`
+	State job.State `json:"state"`
+
+	// name of the node which saved the state
+	Node string `json:"node"`
+}
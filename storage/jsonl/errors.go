@@ -0,0 +1,22 @@
+package jsonl
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrClosed = errors.New("storage is closed")
+)
+
+// CorruptError is returned when a line of a segment isn't a valid
+// record.
+type CorruptError struct {
+	Segment string
+	Line    int
+	Err     error
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("corrupt record at %s:%d: %v", e.Segment, e.Line, e.Err)
+}
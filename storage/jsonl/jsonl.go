@@ -0,0 +1,412 @@
+// Package jsonl appends job states as JSON lines to local files, rotating
+// and optionally compressing them, for auditing and offline analysis.
+package jsonl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/storage"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy decides when written records are synced to disk.
+type SyncPolicy string
+
+const (
+	// after every record
+	SyncAlways SyncPolicy = "always"
+
+	// on writes at most once per SyncInterval, and on rotation
+	SyncInterval SyncPolicy = "interval"
+
+	// left to the operating system, except for rotation
+	SyncNever SyncPolicy = "never"
+)
+
+const (
+	// name of the segment records are appended to
+	active = "states.jsonl"
+
+	// rotated segments are named with the time they were rotated at,
+	// which orders them
+	rotatedFormat = "20060102T150405.000000000Z"
+)
+
+// Storage appends every saved state to the active segment in its
+// directory, rotating it once it grows past MaxSize or gets older than
+// MaxAge. Zero limits disable the corresponding rotation. It implements
+// storage.Storage and storage.Reader, reads replaying all segments.
+type Storage struct {
+	MaxSize int64
+	MaxAge  time.Duration
+
+	// gzip rotated segments, ones left uncompressed by a crash are
+	// compressed on the first write
+	Compress bool
+
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+
+	dir  string
+	node string
+
+	// nil after a failed rotation until the active segment is reopened
+	file   *os.File
+	size   int64
+	opened time.Time
+	synced time.Time
+
+	closed bool
+
+	// rotated segments left uncompressed by a previous run are yet to
+	// be compressed
+	leftover bool
+
+	// held by readers, and by compression while it replaces segments
+	segments *sync.RWMutex
+	wg       *sync.WaitGroup
+
+	log *zap.Logger
+
+	mu *sync.Mutex
+}
+
+// New opens the active segment in dir, creating both if they don't
+// exist. States are recorded as saved by node.
+func New(dir, node string, log *zap.Logger) (*Storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &Storage{
+		MaxSize:      64 << 20,
+		MaxAge:       24 * time.Hour,
+		Compress:     true,
+		Sync:         SyncInterval,
+		SyncInterval: time.Second,
+		dir:          dir,
+		node:         node,
+		leftover:     true,
+		segments:     new(sync.RWMutex),
+		wg:           new(sync.WaitGroup),
+		log:          log,
+		mu:           new(sync.Mutex),
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the active segment, the age of an existing one is counted
+// from the time it's opened at
+func (s *Storage) open() error {
+	path := filepath.Join(s.dir, active)
+	if err := truncateTorn(path); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.file = f
+	s.size = info.Size()
+	s.opened = time.Now()
+	s.synced = s.opened
+	return nil
+}
+
+// truncateTorn cuts the segment at path back to its last complete line,
+// so that a line torn by a crash isn't continued by the next record
+func truncateTorn(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4096)
+	end := info.Size()
+	for end > 0 {
+		n := int64(len(buf))
+		if n > end {
+			n = end
+		}
+		if _, err := f.ReadAt(buf[:n], end-n); err != nil {
+			return err
+		}
+
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			end = end - n + int64(i) + 1
+			break
+		}
+		end -= n
+	}
+
+	if end == info.Size() {
+		return nil
+	}
+	if err := f.Truncate(end); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// implements storage.Storage
+func (s *Storage) SaveJobState(id job.ID, state job.State) error {
+	line, err := json.Marshal(storage.Record{
+		Job:   id,
+		State: state,
+		Node:  s.node,
+	})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reopen(); err != nil {
+		return err
+	}
+
+	if s.leftover {
+		s.leftover = false
+		s.compressLeftover()
+	}
+
+	if s.rotationDue(int64(len(line))) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if s.Sync == SyncAlways || (s.Sync == SyncInterval && now.Sub(s.synced) >= s.SyncInterval) {
+		s.synced = now
+		return s.file.Sync()
+	}
+	return nil
+}
+
+// rotationDue reports whether the active segment has to be rotated
+// before n more bytes are written to it, s.mu must be held
+func (s *Storage) rotationDue(n int64) bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.MaxSize > 0 && s.size+n > s.MaxSize {
+		return true
+	}
+	return s.MaxAge > 0 && time.Since(s.opened) >= s.MaxAge
+}
+
+// Rotate closes the active segment and starts a new one.
+func (s *Storage) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reopen(); err != nil {
+		return err
+	}
+	return s.rotate()
+}
+
+// reopen opens the active segment again if a failed rotation left it
+// closed, s.mu must be held
+func (s *Storage) reopen() error {
+	if s.closed {
+		return ErrClosed
+	}
+	if s.file != nil {
+		return nil
+	}
+	return s.open()
+}
+
+// rotate renames the active segment and opens a new one, compressing the
+// rotated one in the background if needed, s.mu must be held. On failure
+// the active segment is reopened, now or by the next write.
+func (s *Storage) rotate() error {
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		s.open()
+		return err
+	}
+
+	rotated := filepath.Join(s.dir, "states-"+time.Now().UTC().Format(rotatedFormat)+".jsonl")
+
+	// readers list and open segments under the lock
+	s.segments.Lock()
+	err = os.Rename(filepath.Join(s.dir, active), rotated)
+	s.segments.Unlock()
+	if err != nil {
+		s.open()
+		return err
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	if s.Compress {
+		s.compressBackground(rotated)
+	}
+	return nil
+}
+
+// compressBackground compresses the segment at path in the background,
+// s.mu must be held
+func (s *Storage) compressBackground(path string) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		if err := s.compress(path); err != nil {
+			s.log.Error("could not compress segment", zap.String("segment", path), zap.Error(err))
+		}
+	}()
+}
+
+// compressLeftover finishes the compression of rotated segments
+// interrupted by a crash, s.mu must be held
+func (s *Storage) compressLeftover() {
+	if !s.Compress {
+		return
+	}
+
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		s.log.Error("could not list segments", zap.String("dir", s.dir), zap.Error(err))
+		return
+	}
+
+	names := map[string]bool{}
+	for _, e := range entries {
+		names[e.Name()] = true
+	}
+
+	for name := range names {
+		path := filepath.Join(s.dir, name)
+
+		switch {
+		case strings.HasSuffix(name, ".gz.tmp"):
+			os.Remove(path)
+		case !strings.HasPrefix(name, "states-") || !strings.HasSuffix(name, ".jsonl"):
+		case names[name+".gz"]:
+			// compressed, but not yet removed
+			s.segments.Lock()
+			os.Remove(path)
+			s.segments.Unlock()
+		default:
+			s.compressBackground(path)
+		}
+	}
+}
+
+// compress replaces the segment at path with its gzipped copy
+func (s *Storage) compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	s.segments.Lock()
+	defer s.segments.Unlock()
+
+	// the segment might have been pruned in the meantime
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		os.Remove(tmp)
+		return nil
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Close syncs and closes the active segment, waiting for rotated ones to
+// be compressed.
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wg.Wait()
+
+	if s.closed {
+		return ErrClosed
+	}
+	s.closed = true
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Sync()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	s.file = nil
+	return err
+}
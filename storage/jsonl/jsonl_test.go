@@ -0,0 +1,347 @@
+package jsonl
+
+import (
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/storage"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStorage(t *testing.T) (*Storage, string) {
+	dir, err := ioutil.TempDir("", "djinn-jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(dir, "test-node", zap.NewNop())
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func replayTimes(t *testing.T, dir string) []int64 {
+	var times []int64
+	err := Replay(dir, func(r storage.Record) error {
+		times = append(times, r.State.Time)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return times
+}
+
+func Test_Storage_Rotate(t *testing.T) {
+	s, dir := newStorage(t)
+	defer os.RemoveAll(dir)
+
+	s.Sync = SyncAlways
+	// fits two records
+	s.MaxSize = 150
+
+	for i := int64(1); i <= 5; i++ {
+		if err := s.SaveJobState("test-job", job.State{State: job.Started, Time: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	var compressed int
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".jsonl.gz") {
+			compressed++
+		} else if f.Name() != active {
+			t.Fatalf("unexpected file: %s", f.Name())
+		}
+	}
+	if compressed != 2 {
+		t.Fatalf("invalid number of compressed segments: expected='2', actual='%d'", compressed)
+	}
+
+	times := replayTimes(t, dir)
+	if len(times) != 5 {
+		t.Fatalf("invalid replay: %v", times)
+	}
+	for i, tm := range times {
+		if tm != int64(i+1) {
+			t.Fatalf("invalid replay order: %v", times)
+		}
+	}
+}
+
+func Test_Replay_Torn(t *testing.T) {
+	s, dir := newStorage(t)
+	defer os.RemoveAll(dir)
+
+	s.SaveJobState("test-job", job.State{State: job.Started, Time: 1})
+	s.Close()
+
+	// a write cut short by a crash
+	f, _ := os.OpenFile(filepath.Join(dir, active), os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"job":"test-job","sta`)
+	f.Close()
+
+	if times := replayTimes(t, dir); len(times) != 1 {
+		t.Fatalf("invalid replay: %v", times)
+	}
+
+	f, _ = os.OpenFile(filepath.Join(dir, active), os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString("\n")
+	f.Close()
+
+	err := Replay(dir, func(storage.Record) error { return nil })
+	if _, ok := err.(*CorruptError); !ok {
+		t.Fatalf("invalid error: expected corrupt record, actual='%v'", err)
+	}
+}
+
+func Test_Storage_RotateFailure(t *testing.T) {
+	s, dir := newStorage(t)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+
+	s.MaxSize = 100
+
+	if err := s.SaveJobState("test-job", job.State{State: job.Started, Time: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rotation can neither rename nor reopen the active segment
+	os.RemoveAll(dir)
+	if err := s.SaveJobState("test-job", job.State{State: job.Started, Time: 2}); err == nil {
+		t.Fatalf("rotation of a removed segment succeeded")
+	}
+
+	os.MkdirAll(dir, 0755)
+	if err := s.SaveJobState("test-job", job.State{State: job.Started, Time: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if times := replayTimes(t, dir); len(times) != 1 || times[0] != 3 {
+		t.Fatalf("invalid replay: %v", times)
+	}
+}
+
+func Test_Storage_CompressLeftover(t *testing.T) {
+	s, dir := newStorage(t)
+	defer os.RemoveAll(dir)
+
+	s.SaveJobState("test-job", job.State{State: job.Started, Time: 1})
+	s.Rotate()
+	s.Close()
+
+	// a crash before the rotated segment was compressed, and one while
+	// another was being replaced
+	s, err := New(dir, "test-node", zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Compress = false
+	s.SaveJobState("test-job", job.State{State: job.Started, Time: 2})
+	s.Rotate()
+	s.Close()
+
+	ioutil.WriteFile(filepath.Join(dir, "states-20190101T000000.000000000Z.jsonl.gz.tmp"), []byte("torn"), 0644)
+
+	s, err = New(dir, "test-node", zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SaveJobState("test-job", job.State{State: job.Started, Time: 3})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	var compressed int
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".jsonl.gz") {
+			compressed++
+		} else if f.Name() != active {
+			t.Fatalf("unexpected file: %s", f.Name())
+		}
+	}
+	if compressed != 2 {
+		t.Fatalf("invalid number of compressed segments: expected='2', actual='%d'", compressed)
+	}
+
+	if times := replayTimes(t, dir); len(times) != 3 {
+		t.Fatalf("invalid replay: %v", times)
+	}
+}
+
+func Test_Storage_TornRestart(t *testing.T) {
+	s, dir := newStorage(t)
+	defer os.RemoveAll(dir)
+
+	s.SaveJobState("test-job", job.State{State: job.Started, Time: 1})
+	s.Close()
+
+	// a write cut short by a crash
+	f, _ := os.OpenFile(filepath.Join(dir, active), os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"job":"test-job","sta`)
+	f.Close()
+
+	s, err := New(dir, "test-node", zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SaveJobState("test-job", job.State{State: job.Started, Time: 2})
+	defer s.Close()
+
+	records, _, err := s.History("test-job", time.Time{}, time.Time{}, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].State.Time != 2 || records[1].State.Time != 1 {
+		t.Fatalf("invalid history: %v", records)
+	}
+}
+
+func Test_Storage_Reader(t *testing.T) {
+	s, dir := newStorage(t)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+
+	for i := int64(1); i <= 5; i++ {
+		s.SaveJobState("a", job.State{State: job.Started, Time: i})
+		if i == 3 {
+			s.Rotate()
+		}
+	}
+	s.SaveJobState("b", job.State{State: job.CPUExceeded, Time: 4})
+
+	latest, err := s.LatestState("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.State.Time != 5 {
+		t.Fatalf("invalid latest state: %v", latest)
+	}
+
+	var times []int64
+	var cursor string
+	for page := 0; ; page++ {
+		records, next, err := s.History("a", time.Unix(2, 0), time.Time{}, 2, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range records {
+			times = append(times, r.State.Time)
+		}
+		if next == "" {
+			break
+		}
+		if page > 3 {
+			t.Fatalf("history not exhausted: %v", times)
+		}
+		cursor = next
+	}
+	if len(times) != 4 || times[0] != 5 || times[3] != 2 {
+		t.Fatalf("invalid history: %v", times)
+	}
+
+	failures, err := s.ListFailures(time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Job != "b" {
+		t.Fatalf("invalid failures: %v", failures)
+	}
+}
+
+func Test_Storage_Prune(t *testing.T) {
+	s, dir := newStorage(t)
+	defer os.RemoveAll(dir)
+	s.Compress = false
+
+	for _, tm := range []int64{100, 200, 0, 300, 0, 400} {
+		if tm == 0 {
+			if err := s.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		s.SaveJobState("a", job.State{State: job.Started, Time: tm})
+	}
+	defer s.Close()
+
+	policy := storage.RetentionPolicy{Default: storage.Retention{Successes: 1}}
+
+	pruned, err := s.Prune(policy, time.Unix(1000, 0), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned.States != 3 || len(replayTimes(t, dir)) != 4 {
+		t.Fatalf("invalid dry run: pruned='%d'", pruned.States)
+	}
+
+	pruned, err = s.Prune(policy, time.Unix(1000, 0), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned.States != 3 || len(pruned.Executions) != 3 {
+		t.Fatalf("invalid number of pruned states: expected='3', actual='%d' (%v)", pruned.States, pruned.Executions)
+	}
+
+	// the active segment is kept
+	times := replayTimes(t, dir)
+	if len(times) != 1 || times[0] != 400 {
+		t.Fatalf("invalid states kept: %v", times)
+	}
+}
+
+func Test_Storage_HistoryCursor(t *testing.T) {
+	s, dir := newStorage(t)
+	defer os.RemoveAll(dir)
+	s.Compress = false
+	defer s.Close()
+
+	s.SaveJobState("b", job.State{State: job.Started, Time: 1})
+	s.Rotate()
+	s.SaveJobState("b", job.State{State: job.Started, Time: 2})
+	s.SaveJobState("a", job.State{State: job.Started, Time: 100})
+	s.SaveJobState("a", job.State{State: job.Started, Time: 200})
+	s.Rotate()
+	s.SaveJobState("a", job.State{State: job.Started, Time: 300})
+	s.SaveJobState("a", job.State{State: job.Started, Time: 400})
+
+	records, cursor, err := s.History("a", time.Time{}, time.Time{}, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1].State.Time != 300 || cursor == "" {
+		t.Fatalf("invalid first page: %v, cursor='%s'", records, cursor)
+	}
+
+	// removes the first segment, then the active one is rotated
+	policy := storage.RetentionPolicy{Jobs: map[job.ID]storage.Retention{"b": {Successes: 1}}}
+	if pruned, err := s.Prune(policy, time.Unix(1000, 0), false); err != nil || pruned.States != 1 {
+		t.Fatalf("invalid prune: pruned='%d', err='%v'", pruned.States, err)
+	}
+	s.Rotate()
+	s.SaveJobState("a", job.State{State: job.Started, Time: 500})
+
+	records, cursor, err = s.History("a", time.Time{}, time.Time{}, 2, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].State.Time != 200 || records[1].State.Time != 100 || cursor != "" {
+		t.Fatalf("invalid second page: %v, cursor='%s'", records, cursor)
+	}
+
+	for _, c := range []string{"1", "states.jsonl", "states.jsonl:0"} {
+		if _, _, err := s.History("a", time.Time{}, time.Time{}, 2, c); err != storage.ErrInvalidCursor {
+			t.Fatalf("invalid error for '%s': expected='%v', actual='%v'", c, storage.ErrInvalidCursor, err)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/storage"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Replay calls fn with every record saved in dir, oldest first, until
+// it returns an error. Lines cut short by a crash at the end of a
+// segment are skipped.
+func Replay(dir string, fn func(storage.Record) error) error {
+	paths, err := segments(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		err := replaySegment(path, func(line int, r storage.Record) error {
+			return fn(r)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// segments returns the paths of segments in dir in the order they were
+// written in, the active one being the last. The order is the one of
+// their names, see segmentName.
+func segments(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// a segment being compressed is briefly present in both forms
+	rotated := map[string]string{}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "states-") {
+			continue
+		}
+
+		base := strings.TrimSuffix(name, ".gz")
+		if !strings.HasSuffix(base, ".jsonl") {
+			continue
+		}
+		if _, ok := rotated[base]; !ok || strings.HasSuffix(name, ".gz") {
+			rotated[base] = name
+		}
+	}
+
+	var bases []string
+	for base := range rotated {
+		bases = append(bases, base)
+	}
+	sort.Strings(bases)
+
+	var paths []string
+	for _, base := range bases {
+		paths = append(paths, filepath.Join(dir, rotated[base]))
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, active)); err == nil {
+		paths = append(paths, filepath.Join(dir, active))
+	}
+	return paths, nil
+}
+
+// segmentName returns the name of the segment at path, which doesn't
+// change once it's compressed. The active segment's name sorts after
+// the ones of rotated segments.
+func segmentName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".gz")
+}
+
+// replaySegment calls fn with every record in the segment at path and
+// the number of the line it's on
+func replaySegment(path string, fn func(int, storage.Record) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			// a partial line is a write cut short
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec storage.Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return &CorruptError{path, n, err}
+		}
+		if err := fn(n, rec); err != nil {
+			return err
+		}
+	}
+}
+
+// position is the segment and line a record is on
+type position struct {
+	segment string
+	line    int
+}
+
+func (p position) before(o position) bool {
+	return p.segment < o.segment || (p.segment == o.segment && p.line < o.line)
+}
+
+// entry is a record together with its position
+type entry struct {
+	position
+	record storage.Record
+}
+
+// replay returns the records accepted by match, oldest first, and the
+// names of the segments they were read from
+func (s *Storage) replay(match func(storage.Record) bool) ([]entry, []string, error) {
+	s.segments.RLock()
+	defer s.segments.RUnlock()
+
+	paths, err := segments(s.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []entry
+	names := make([]string, 0, len(paths))
+	for _, path := range paths {
+		name := segmentName(path)
+		names = append(names, name)
+
+		err := replaySegment(path, func(line int, r storage.Record) error {
+			if match(r) {
+				entries = append(entries, entry{position{name, line}, r})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return entries, names, nil
+}
+
+// cursor returns the cursor continuing a listing before p. The active
+// segment is renamed once it's rotated, so it's referred to as the one
+// following the last rotated segment, its name followed by "+".
+func cursor(p position, names []string) string {
+	segment := p.segment
+	if segment == active {
+		segment = "+"
+		for _, name := range names {
+			if name != active {
+				segment = name + "+"
+			}
+		}
+	}
+	return segment + ":" + strconv.Itoa(p.line)
+}
+
+// parseCursor returns the position a listing continues before, names
+// being the segments it's continued from
+func parseCursor(c string, names []string) (position, error) {
+	i := strings.LastIndex(c, ":")
+	if i < 0 {
+		return position{}, storage.ErrInvalidCursor
+	}
+
+	line, err := strconv.Atoi(c[i+1:])
+	if err != nil || line <= 0 {
+		return position{}, storage.ErrInvalidCursor
+	}
+
+	segment := c[:i]
+	if !strings.HasSuffix(segment, "+") {
+		return position{segment, line}, nil
+	}
+
+	// the segment following the given one
+	prev := strings.TrimSuffix(segment, "+")
+	for _, name := range names {
+		if name > prev {
+			return position{name, line}, nil
+		}
+	}
+	return position{active, line}, nil
+}
+
+// implements storage.Reader
+func (s *Storage) LatestState(id job.ID) (*storage.Record, error) {
+	entries, _, err := s.replay(func(r storage.Record) bool {
+		return r.Job == id
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return &entries[len(entries)-1].record, nil
+}
+
+// implements storage.Reader, the cursor is the segment and line of the
+// last listed record, so it isn't affected by pruning
+func (s *Storage) History(id job.ID, from, to time.Time, limit int, c string) ([]storage.Record, string, error) {
+	entries, names, err := s.replay(func(r storage.Record) bool {
+		if r.Job != id {
+			return false
+		}
+		if !from.IsZero() && r.State.Time < from.Unix() {
+			return false
+		}
+		return to.IsZero() || r.State.Time < to.Unix()
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var before *position
+	if c != "" {
+		p, err := parseCursor(c, names)
+		if err != nil {
+			return nil, "", err
+		}
+		before = &p
+	}
+
+	var records []storage.Record
+	for i := len(entries) - 1; i >= 0; i-- {
+		if before != nil && !entries[i].before(*before) {
+			continue
+		}
+
+		// there are records left past the listed ones
+		if limit > 0 && len(records) == limit {
+			return records, cursor(entries[i+1].position, names), nil
+		}
+		records = append(records, entries[i].record)
+	}
+	return records, "", nil
+}
+
+// implements storage.Reader
+func (s *Storage) ListFailures(since time.Time, limit int) ([]storage.Record, error) {
+	entries, _, err := s.replay(func(r storage.Record) bool {
+		return r.State.State.Failed() && r.State.Time >= since.Unix()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	failures := make([]storage.Record, 0, len(entries))
+	for i := len(entries) - 1; i >= 0 && (limit <= 0 || len(failures) < limit); i-- {
+		failures = append(failures, entries[i].record)
+	}
+	return failures, nil
+}
+
+// implements storage.Pruner, segments are append-only so only rotated
+// segments whose every state expired are removed
+func (s *Storage) Prune(policy storage.RetentionPolicy, now time.Time, dryRun bool) (storage.Pruned, error) {
+	var pruned storage.Pruned
+
+	s.segments.Lock()
+	defer s.segments.Unlock()
+
+	paths, err := segments(s.dir)
+	if err != nil {
+		return pruned, err
+	}
+
+	var records []storage.Record
+	counts := make([]int, len(paths))
+	for i, path := range paths {
+		err := replaySegment(path, func(line int, r storage.Record) error {
+			records = append(records, r)
+			counts[i]++
+			return nil
+		})
+		if err != nil {
+			return pruned, err
+		}
+	}
+	expired := policy.Expired(records, now)
+
+	// states of every expired execution left to remove, an execution
+	// may span segments
+	left := map[storage.Execution]int{}
+	for _, r := range records {
+		if e := (storage.Execution{Job: r.Job, Time: r.State.Time}); expired[e] {
+			left[e]++
+		}
+	}
+
+	var next int
+	for i, path := range paths {
+		segment := records[next : next+counts[i]]
+		next += counts[i]
+
+		// the active segment is still being written to
+		if filepath.Base(path) == active {
+			continue
+		}
+
+		removable := true
+		for _, r := range segment {
+			if !expired[storage.Execution{Job: r.Job, Time: r.State.Time}] {
+				removable = false
+				break
+			}
+		}
+		if !removable {
+			continue
+		}
+
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return pruned, err
+			}
+		}
+		pruned.States += len(segment)
+
+		for _, r := range segment {
+			e := storage.Execution{Job: r.Job, Time: r.State.Time}
+			left[e]--
+			if left[e] == 0 {
+				pruned.Executions = append(pruned.Executions, e)
+			}
+		}
+	}
+	return pruned, nil
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"github.com/mewa/djinn/djinn/job"
+	"sort"
+	"time"
+)
+
+// Pruner is implemented by storages able to remove saved states.
+type Pruner interface {
+	// Prune removes the states of executions the policy doesn't keep
+	// at the given time, returning what it removed, also when it fails
+	// part way. In a dry run nothing is removed and what would be is
+	// returned.
+	Prune(policy RetentionPolicy, now time.Time, dryRun bool) (Pruned, error)
+}
+
+// Pruned describes the states removed by a prune.
+type Pruned struct {
+	// number of removed states
+	States int
+
+	// executions none of whose states are left, their results and
+	// artifacts can be removed as well
+	Executions []Execution
+}
+
+// Retention decides which executions of a job are kept, an execution
+// being kept if any of the rules keeps it. A zero retention keeps
+// everything.
+type Retention struct {
+	// number of latest successful and failed executions kept
+	Successes int `json:"successes"`
+	Failures  int `json:"failures"`
+
+	// executions younger than MaxAge are kept
+	MaxAge time.Duration `json:"max_age"`
+}
+
+// RetentionPolicy applies retentions to jobs, the latest and unfinished
+// executions of every job are always kept.
+type RetentionPolicy struct {
+	Default Retention            `json:"default"`
+	Jobs    map[job.ID]Retention `json:"jobs"`
+}
+
+// Execution identifies the states saved by an execution.
+type Execution struct {
+	Job  job.ID
+	Time int64
+}
+
+// For returns the retention applied to the job.
+func (p RetentionPolicy) For(id job.ID) Retention {
+	if r, ok := p.Jobs[id]; ok {
+		return r
+	}
+	return p.Default
+}
+
+// Expired returns the executions of records which aren't kept at the
+// given time.
+func (p RetentionPolicy) Expired(records []Record, now time.Time) map[Execution]bool {
+	// final state of every execution
+	final := map[Execution]job.State{}
+	for _, r := range records {
+		e := Execution{r.Job, r.State.Time}
+		if s, ok := final[e]; !ok || !finished(s) {
+			final[e] = r.State
+		}
+	}
+
+	executions := map[job.ID][]Execution{}
+	for e := range final {
+		executions[e.Job] = append(executions[e.Job], e)
+	}
+
+	expired := map[Execution]bool{}
+	for id, es := range executions {
+		r := p.For(id)
+		if r == (Retention{}) {
+			continue
+		}
+
+		// latest first
+		sort.Slice(es, func(i, j int) bool { return es[i].Time > es[j].Time })
+
+		var successes, failures int
+		for i, e := range es {
+			st := final[e]
+
+			// states other than outcomes of executions are kept
+			kept := true
+			if st.State == job.Started {
+				successes++
+				kept = successes <= r.Successes
+			} else if finished(st) {
+				failures++
+				kept = failures <= r.Failures
+			}
+
+			if i == 0 || (r.MaxAge > 0 && now.Sub(time.Unix(e.Time, 0)) < r.MaxAge) {
+				kept = true
+			}
+			if !kept {
+				expired[e] = true
+			}
+		}
+	}
+	return expired
+}
+
+// finished reports whether the state is the outcome of an execution
+func finished(s job.State) bool {
+	return s.State == job.Started || s.State == job.Cancelled || s.State.Failed()
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"github.com/mewa/djinn/djinn/job"
+	"testing"
+	"time"
+)
+
+func Test_RetentionPolicy_Expired(t *testing.T) {
+	records := []Record{
+		{Job: "a", State: job.State{State: job.Started, Time: 100}},
+		{Job: "a", State: job.State{State: job.Starting, Time: 200}},
+		{Job: "a", State: job.State{State: job.Error, Time: 200}},
+		{Job: "a", State: job.State{State: job.Started, Time: 300}},
+		{Job: "a", State: job.State{State: job.Error, Time: 400}},
+		{Job: "a", State: job.State{State: job.Started, Time: 900}},
+		// unfinished
+		{Job: "a", State: job.State{State: job.Running, Time: 50}},
+		// kept by its own retention
+		{Job: "b", State: job.State{State: job.Started, Time: 100}},
+		{Job: "b", State: job.State{State: job.Started, Time: 200}},
+	}
+
+	policy := RetentionPolicy{
+		Default: Retention{Successes: 1, Failures: 1, MaxAge: 200 * time.Second},
+		Jobs: map[job.ID]Retention{
+			"b": {},
+		},
+	}
+
+	expired := policy.Expired(records, time.Unix(1000, 0))
+
+	expected := map[Execution]bool{
+		{"a", 100}: true,
+		{"a", 200}: true,
+		{"a", 300}: true,
+	}
+	if len(expired) != len(expected) {
+		t.Fatalf("invalid expired executions: expected='%v', actual='%v'", expected, expired)
+	}
+	for e := range expected {
+		if !expired[e] {
+			t.Fatalf("execution not expired: %v", e)
+		}
+	}
+}
+
+func Test_RetentionPolicy_Latest(t *testing.T) {
+	records := []Record{
+		{Job: "a", State: job.State{State: job.Error, Time: 100}},
+	}
+
+	policy := RetentionPolicy{Default: Retention{Successes: 1}}
+	if expired := policy.Expired(records, time.Unix(1000, 0)); len(expired) != 0 {
+		t.Fatalf("latest execution expired: %v", expired)
+	}
+}
@@ -0,0 +1,21 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNewerSchema = errors.New("database schema is newer than supported")
+)
+
+// MigrationError is returned when the schema couldn't be migrated to
+// Version.
+type MigrationError struct {
+	Version int
+	Err     error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("migration to version %d failed: %v", e.Version, e.Err)
+}
@@ -0,0 +1,69 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations upgrade the schema one version at a time, the version of a
+// database being the number of migrations applied to it. Released
+// migrations must never change, new ones are appended.
+var migrations = []string{
+	`CREATE TABLE states (
+		id    INTEGER PRIMARY KEY AUTOINCREMENT,
+		job   TEXT    NOT NULL,
+		state TEXT    NOT NULL,
+		time  INTEGER NOT NULL,
+		node  TEXT    NOT NULL
+	);
+	CREATE INDEX states_job ON states (job, time);
+	CREATE INDEX states_time ON states (time);
+	CREATE INDEX states_state ON states (state, time);`,
+
+	`CREATE TABLE results (
+		id      INTEGER PRIMARY KEY AUTOINCREMENT,
+		job     TEXT    NOT NULL,
+		time    INTEGER NOT NULL,
+		outcome TEXT    NOT NULL,
+		node    TEXT    NOT NULL,
+		result  BLOB    NOT NULL
+	);
+	CREATE INDEX results_job ON results (job, time);
+	CREATE INDEX results_outcome ON results (outcome, time);`,
+}
+
+// migrate brings the schema of db up to date, each migration being
+// applied in its own transaction
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return ErrNewerSchema
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return &MigrationError{version + 1, err}
+		}
+
+		// pragmas don't accept parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return &MigrationError{version + 1, err}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
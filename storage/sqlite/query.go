@@ -0,0 +1,320 @@
+package sqlite
+
+import (
+	"fmt"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/storage"
+	"strings"
+	"time"
+)
+
+// Query selects saved states, zero fields don't restrict the selection.
+type Query struct {
+	Job job.ID
+
+	// names of the states, e.g. "error"
+	States []string
+
+	// states saved within [From, To)
+	From time.Time
+	To   time.Time
+
+	Limit int
+}
+
+// position of a record in the listing, ordered by time and then by
+// insertion
+type position struct {
+	time int64
+	id   int64
+}
+
+func (p position) String() string {
+	return fmt.Sprintf("%d.%d", p.time, p.id)
+}
+
+func parseCursor(cursor string) (*position, error) {
+	var p position
+	if _, err := fmt.Sscanf(cursor, "%d.%d", &p.time, &p.id); err != nil {
+		return nil, storage.ErrInvalidCursor
+	}
+	return &p, nil
+}
+
+// States returns the states selected by q, latest first.
+func (s *Storage) States(q Query) ([]storage.Record, error) {
+	records, _, err := s.states(q, nil)
+	return records, err
+}
+
+// states returns the states selected by q listed after the given
+// position, together with the position of each of them
+func (s *Storage) states(q Query, after *position) ([]storage.Record, []position, error) {
+	var where []string
+	var args []interface{}
+
+	if q.Job != "" {
+		where = append(where, "job = ?")
+		args = append(args, string(q.Job))
+	}
+	if len(q.States) > 0 {
+		for _, name := range q.States {
+			if _, err := job.ParseState(name); err != nil {
+				return nil, nil, err
+			}
+			args = append(args, name)
+		}
+		where = append(where, "state IN (?"+strings.Repeat(", ?", len(q.States)-1)+")")
+	}
+	if !q.From.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, q.From.Unix())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, q.To.Unix())
+	}
+	if after != nil {
+		where = append(where, "(time < ? OR (time = ? AND id < ?))")
+		args = append(args, after.time, after.time, after.id)
+	}
+
+	query := "SELECT id, job, state, time, node FROM states"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY time DESC, id DESC"
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var records []storage.Record
+	var positions []position
+	for rows.Next() {
+		var id, name string
+		var r storage.Record
+		var p position
+
+		if err := rows.Scan(&p.id, &id, &name, &r.State.Time, &r.Node); err != nil {
+			return nil, nil, err
+		}
+
+		st, err := job.ParseState(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		r.Job = job.ID(id)
+		r.State.State = st
+		p.time = r.State.Time
+
+		records = append(records, r)
+		positions = append(positions, p)
+	}
+	return records, positions, rows.Err()
+}
+
+// ByJob returns up to limit latest states of the job.
+func (s *Storage) ByJob(id job.ID, limit int) ([]storage.Record, error) {
+	return s.States(Query{Job: id, Limit: limit})
+}
+
+// ByTime returns up to limit latest states saved within [from, to).
+func (s *Storage) ByTime(from, to time.Time, limit int) ([]storage.Record, error) {
+	return s.States(Query{From: from, To: to, Limit: limit})
+}
+
+// ByState returns up to limit latest states named state.
+func (s *Storage) ByState(state string, limit int) ([]storage.Record, error) {
+	return s.States(Query{States: []string{state}, Limit: limit})
+}
+
+// implements storage.Reader
+func (s *Storage) LatestState(id job.ID) (*storage.Record, error) {
+	records, err := s.ByJob(id, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return &records[0], nil
+}
+
+// implements storage.Reader
+func (s *Storage) History(id job.ID, from, to time.Time, limit int, cursor string) ([]storage.Record, string, error) {
+	var after *position
+	if cursor != "" {
+		p, err := parseCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after = p
+	}
+
+	q := Query{Job: id, From: from, To: to}
+	if limit > 0 {
+		// an extra record tells whether there's anything left
+		q.Limit = limit + 1
+	}
+
+	records, positions, err := s.states(q, after)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if limit > 0 && len(records) > limit {
+		return records[:limit], positions[limit-1].String(), nil
+	}
+	return records, "", nil
+}
+
+// implements storage.Reader
+func (s *Storage) ListFailures(since time.Time, limit int) ([]storage.Record, error) {
+	var failed []string
+	for st := job.Initial; st <= job.Running; st++ {
+		if st.Failed() {
+			failed = append(failed, st.String())
+		}
+	}
+	return s.States(Query{States: failed, From: since, Limit: limit})
+}
+
+// implements storage.Pruner, results of expired executions are removed
+// with their states
+func (s *Storage) Prune(policy storage.RetentionPolicy, now time.Time, dryRun bool) (storage.Pruned, error) {
+	var pruned storage.Pruned
+
+	expired, args := expiredQuery(policy, now)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return pruned, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(expired+"SELECT job, time FROM expired", args...)
+	if err != nil {
+		return pruned, err
+	}
+	for rows.Next() {
+		var e storage.Execution
+		var id string
+		if err := rows.Scan(&id, &e.Time); err != nil {
+			rows.Close()
+			return storage.Pruned{}, err
+		}
+		e.Job = job.ID(id)
+		pruned.Executions = append(pruned.Executions, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return storage.Pruned{}, err
+	}
+
+	if len(pruned.Executions) == 0 {
+		return pruned, nil
+	}
+
+	if dryRun {
+		err := tx.QueryRow(expired+"SELECT COUNT(*) FROM states WHERE (job, time) IN (SELECT job, time FROM expired)", args...).Scan(&pruned.States)
+		if err != nil {
+			return storage.Pruned{}, err
+		}
+		return pruned, nil
+	}
+
+	// results go first, the selection relies on the states
+	if _, err := tx.Exec(expired+"DELETE FROM results WHERE (job, time) IN (SELECT job, time FROM expired)", args...); err != nil {
+		return storage.Pruned{}, err
+	}
+	res, err := tx.Exec(expired+"DELETE FROM states WHERE (job, time) IN (SELECT job, time FROM expired)", args...)
+	if err != nil {
+		return storage.Pruned{}, err
+	}
+	states, err := res.RowsAffected()
+	if err != nil {
+		return storage.Pruned{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.Pruned{}, err
+	}
+	pruned.States = int(states)
+	return pruned, nil
+}
+
+// expiredQuery returns the common table expressions selecting the
+// executions the policy doesn't keep at the given time as expired, the
+// same ones storage.RetentionPolicy.Expired does
+func expiredQuery(policy storage.RetentionPolicy, now time.Time) (string, []interface{}) {
+	var values []string
+	var args []interface{}
+
+	retention := func(id interface{}, r storage.Retention) {
+		// executions saved at keep_from or later are young enough to
+		// be kept
+		var keepFrom interface{}
+		if r.MaxAge > 0 {
+			keepFrom = now.Add(-r.MaxAge).Unix() + 1
+		}
+
+		values = append(values, "(?, ?, ?, ?, ?)")
+		args = append(args, id, r != (storage.Retention{}), r.Successes, r.Failures, keepFrom)
+	}
+
+	// the default retention applies to jobs without one of their own
+	retention(nil, policy.Default)
+	for id, r := range policy.Jobs {
+		retention(string(id), r)
+	}
+
+	failed := []interface{}{job.Cancelled.String(), job.Error.String(), job.MemoryExceeded.String(), job.CPUExceeded.String()}
+	args = append(args, job.Started.String())
+	args = append(args, failed...)
+
+	return `WITH
+		retention (job, enabled, successes, failures, keep_from) AS (
+			VALUES ` + strings.Join(values, ", ") + `
+		),
+		outcomes AS (
+			SELECT id, job, time, CASE
+				WHEN state = ? THEN 'success'
+				WHEN state IN (?` + strings.Repeat(", ?", len(failed)-1) + `) THEN 'failure'
+			END AS outcome
+			FROM states
+		),
+		-- the latest outcome of every execution, if there's any
+		finals AS (
+			SELECT job, time, outcome, ROW_NUMBER() OVER (
+				PARTITION BY job, time
+				ORDER BY outcome IS NOT NULL DESC, id DESC
+			) AS n
+			FROM outcomes
+		),
+		executions AS (
+			SELECT job, time, outcome,
+				ROW_NUMBER() OVER (PARTITION BY job ORDER BY time DESC) AS latest,
+				ROW_NUMBER() OVER (PARTITION BY job, outcome ORDER BY time DESC) AS n
+			FROM finals
+			WHERE n = 1
+		),
+		expired AS (
+			SELECT e.job, e.time
+			FROM executions e
+			JOIN retention r ON r.job = e.job OR (r.job IS NULL AND e.job NOT IN (
+				SELECT job FROM retention WHERE job IS NOT NULL
+			))
+			WHERE r.enabled AND e.latest > 1
+				AND (r.keep_from IS NULL OR e.time < r.keep_from)
+				AND ((e.outcome = 'success' AND e.n > r.successes) OR
+					(e.outcome = 'failure' AND e.n > r.failures))
+		)
+	`, args
+}
@@ -0,0 +1,68 @@
+// Package sqlite stores the history of job states and execution results
+// in a SQLite database.
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mewa/djinn/djinn/job"
+	"net/url"
+)
+
+// Storage records every saved job state together with the name of the
+// node which saved it. It implements storage.Storage and
+// storage.ResultStorage.
+type Storage struct {
+	db   *sql.DB
+	node string
+}
+
+// New opens the database at path, creating it and its schema if it
+// doesn't exist and migrating it otherwise. States are recorded as saved
+// by node.
+func New(path, node string) (*Storage, error) {
+	params := url.Values{}
+	params.Set("_busy_timeout", "5000")
+	params.Set("_journal_mode", "WAL")
+
+	db, err := sql.Open("sqlite3", path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer at a time
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Storage{
+		db:   db,
+		node: node,
+	}, nil
+}
+
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// implements storage.Storage
+func (s *Storage) SaveJobState(id job.ID, state job.State) error {
+	_, err := s.db.Exec("INSERT INTO states (job, state, time, node) VALUES (?, ?, ?, ?)",
+		string(id), state.State.String(), state.Time, s.node)
+	return err
+}
+
+// implements storage.ResultStorage
+func (s *Storage) SaveJobResult(id job.ID, result job.Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("INSERT INTO results (job, time, outcome, node, result) VALUES (?, ?, ?, ?, ?)",
+		string(id), result.Time, string(result.Outcome), s.node, data)
+	return err
+}
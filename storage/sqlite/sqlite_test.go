@@ -0,0 +1,289 @@
+package sqlite
+
+import (
+	"database/sql"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/storage"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newStorage(t *testing.T) (*Storage, func()) {
+	dir, err := ioutil.TempDir("", "djinn-sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(filepath.Join(dir, "history.db"), "test-node")
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func Test_Storage_Queries(t *testing.T) {
+	s, cleanup := newStorage(t)
+	defer cleanup()
+
+	states := []struct {
+		id    job.ID
+		state job.State
+	}{
+		{"a", job.State{State: job.Starting, Time: 100}},
+		{"a", job.State{State: job.Started, Time: 100}},
+		{"b", job.State{State: job.Starting, Time: 200}},
+		{"b", job.State{State: job.Error, Time: 200}},
+		{"a", job.State{State: job.Error, Time: 300}},
+	}
+	for _, st := range states {
+		if err := s.SaveJobState(st.id, st.state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := s.ByJob("a", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].State != (job.State{State: job.Error, Time: 300}) {
+		t.Fatalf("invalid job history: %v", records)
+	}
+	if records[0].Node != "test-node" {
+		t.Fatalf("invalid node: expected='test-node', actual='%s'", records[0].Node)
+	}
+
+	records, err = s.ByTime(time.Unix(100, 0), time.Unix(300, 0), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].Job != "b" || records[2].State.State != job.Started {
+		t.Fatalf("invalid time range: %v", records)
+	}
+
+	records, err = s.ByState("error", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Job != "a" || records[1].Job != "b" {
+		t.Fatalf("invalid states: %v", records)
+	}
+
+	if _, err := s.ByState("broken", 0); err != job.ErrUnknownState {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", job.ErrUnknownState, err)
+	}
+}
+
+func Test_Migrate(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// a database created before results were stored
+	if _, err := db.Exec(migrations[0] + "PRAGMA user_version = 1;"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO states (job, state, time, node) VALUES ('a', 'started', 1, 'old')"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var version, states int
+	db.QueryRow("PRAGMA user_version").Scan(&version)
+	db.QueryRow("SELECT COUNT(*) FROM states").Scan(&states)
+
+	if version != len(migrations) {
+		t.Fatalf("invalid version: expected='%d', actual='%d'", len(migrations), version)
+	}
+	if states != 1 {
+		t.Fatalf("states lost in migration: %d", states)
+	}
+	if _, err := db.Exec("INSERT INTO results (job, time, outcome, node, result) VALUES ('a', 1, 'success', 'new', '{}')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// migrating an up to date database is a no-op
+	if err := migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Exec("PRAGMA user_version = 100")
+	if err := migrate(db); err != ErrNewerSchema {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrNewerSchema, err)
+	}
+}
+
+func Test_Storage_Reader(t *testing.T) {
+	s, cleanup := newStorage(t)
+	defer cleanup()
+
+	if _, err := s.LatestState("a"); err != storage.ErrNotFound {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", storage.ErrNotFound, err)
+	}
+
+	for i := int64(1); i <= 5; i++ {
+		s.SaveJobState("a", job.State{State: job.Started, Time: i})
+	}
+	s.SaveJobState("a", job.State{State: job.MemoryExceeded, Time: 6})
+	s.SaveJobState("b", job.State{State: job.Error, Time: 2})
+
+	latest, err := s.LatestState("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.State.State != job.MemoryExceeded {
+		t.Fatalf("invalid latest state: expected='%v', actual='%v'", job.MemoryExceeded, latest.State.State)
+	}
+
+	var times []int64
+	var cursor string
+	for page := 0; ; page++ {
+		records, next, err := s.History("a", time.Time{}, time.Unix(6, 0), 2, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range records {
+			times = append(times, r.State.Time)
+		}
+		if next == "" {
+			break
+		}
+		if page > 3 {
+			t.Fatalf("history not exhausted: %v", times)
+		}
+		cursor = next
+	}
+	if len(times) != 5 || times[0] != 5 || times[4] != 1 {
+		t.Fatalf("invalid history: %v", times)
+	}
+
+	if _, _, err := s.History("a", time.Time{}, time.Time{}, 2, "broken"); err != storage.ErrInvalidCursor {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", storage.ErrInvalidCursor, err)
+	}
+
+	failures, err := s.ListFailures(time.Unix(2, 0), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 2 || failures[0].Job != "a" || failures[1].Job != "b" {
+		t.Fatalf("invalid failures: %v", failures)
+	}
+
+	failures, err = s.ListFailures(time.Unix(2, 0), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Job != "a" {
+		t.Fatalf("invalid limited failures: %v", failures)
+	}
+}
+
+func Test_Storage_Prune(t *testing.T) {
+	s, cleanup := newStorage(t)
+	defer cleanup()
+
+	for _, tm := range []int64{100, 200, 300} {
+		s.SaveJobState("a", job.State{State: job.Starting, Time: tm})
+		s.SaveJobState("a", job.State{State: job.Started, Time: tm})
+		s.SaveJobResult("a", job.Result{Time: tm})
+	}
+
+	policy := storage.RetentionPolicy{Default: storage.Retention{Successes: 2}}
+
+	pruned, err := s.Prune(policy, time.Unix(1000, 0), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned.States != 2 {
+		t.Fatalf("invalid dry run: expected='2', actual='%d'", pruned.States)
+	}
+	if records, _ := s.ByJob("a", 0); len(records) != 6 {
+		t.Fatalf("dry run removed states: %v", records)
+	}
+
+	pruned, err = s.Prune(policy, time.Unix(1000, 0), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned.States != 2 {
+		t.Fatalf("invalid number of pruned states: expected='2', actual='%d'", pruned.States)
+	}
+	if len(pruned.Executions) != 1 || pruned.Executions[0] != (storage.Execution{Job: "a", Time: 100}) {
+		t.Fatalf("invalid pruned executions: %v", pruned.Executions)
+	}
+
+	records, _ := s.ByJob("a", 0)
+	if len(records) != 4 || records[len(records)-1].State.Time != 200 {
+		t.Fatalf("invalid states kept: %v", records)
+	}
+
+	var results int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM results").Scan(&results); err != nil {
+		t.Fatal(err)
+	}
+	if results != 2 {
+		t.Fatalf("invalid number of results kept: expected='2', actual='%d'", results)
+	}
+}
+
+func Test_Storage_PruneExpired(t *testing.T) {
+	s, cleanup := newStorage(t)
+	defer cleanup()
+
+	outcomes := []job.State{
+		{State: job.Started}, {State: job.Error}, {State: job.Started},
+		{State: job.Cancelled}, {State: job.Starting}, {State: job.Started},
+		{State: job.CPUExceeded}, {State: job.Started},
+	}
+	for _, id := range []job.ID{"a", "b", "c"} {
+		for i, st := range outcomes {
+			tm := int64(100 * (i + 1))
+			s.SaveJobState(id, job.State{State: job.Starting, Time: tm})
+			if st.State != job.Starting {
+				s.SaveJobState(id, job.State{State: st.State, Time: tm})
+			}
+		}
+	}
+
+	policy := storage.RetentionPolicy{
+		Default: storage.Retention{Successes: 1, Failures: 1},
+		Jobs: map[job.ID]storage.Retention{
+			"b": {Successes: 2, MaxAge: 450 * time.Second},
+			"c": {},
+		},
+	}
+	now := time.Unix(1000, 0)
+
+	records, err := s.States(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := policy.Expired(records, now)
+
+	pruned, err := s.Prune(policy, now, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := map[storage.Execution]bool{}
+	for _, e := range pruned.Executions {
+		actual[e] = true
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("invalid expired executions: expected='%v', actual='%v'", expected, actual)
+	}
+}
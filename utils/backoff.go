@@ -1,22 +1,40 @@
 package utils
 
 import (
+	"context"
 	"math/rand"
 	"time"
 )
 
-func Backoff(min, timeout time.Duration, fn func () error) {
+// Backoff calls fn until it succeeds or the timeout elapses, sleeping
+// for a randomised, growing period between calls. It returns the error
+// of the last call.
+func Backoff(min, timeout time.Duration, fn func() error) error {
+	return BackoffContext(context.Background(), min, timeout, fn)
+}
+
+// BackoffContext is Backoff which stops retrying once ctx is done.
+func BackoffContext(ctx context.Context, min, timeout time.Duration, fn func() error) error {
 	var elapsed time.Duration
+	var err error
 
-	wait := min + min * time.Duration(rand.Float32())
+	wait := min + time.Duration(float64(min)*rand.Float64())
 
 retry:
 	if elapsed < timeout {
-		if err := fn(); err != nil {
-			time.Sleep(wait)
+		if err = fn(); err != nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+
 			elapsed += wait
-			wait *= time.Duration(1.5 + 0.75 * rand.Float32())
+			wait = time.Duration(float64(wait) * (1.5 + 0.75*rand.Float64()))
 			goto retry
 		}
 	}
+	return err
 }
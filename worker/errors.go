@@ -0,0 +1,11 @@
+package worker
+
+import (
+	"errors"
+)
+
+var (
+	ErrInvalidLease = errors.New("execution claimed without a lease")
+
+	errNoContent = errors.New("no content")
+)
@@ -0,0 +1,196 @@
+// Package worker runs executions dispatched by djinn's remote.Dispatcher
+// in a separate process.
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mewa/djinn/executor"
+	"github.com/mewa/djinn/executor/remote"
+	"github.com/mewa/djinn/utils"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// shortest interval between heartbeats, however short the lease
+const minHeartbeat = 10 * time.Millisecond
+
+// Worker claims executions from djinn nodes and runs them with its
+// executor.
+type Worker struct {
+	Name string
+
+	// base URLs of the dispatcher API on every djinn node, e.g.
+	// http://djinn-1:4444/executions
+	Endpoints []string
+
+	// kinds of jobs the worker runs, empty means any
+	Kinds []string
+
+	Client *http.Client
+
+	// how long a claim request waits for an execution
+	Wait time.Duration
+
+	executor executor.ContextExecutor
+
+	log *zap.Logger
+}
+
+func New(name string, endpoints []string, ex executor.Executor, log *zap.Logger) *Worker {
+	return &Worker{
+		Name:      name,
+		Endpoints: endpoints,
+
+		Client: &http.Client{},
+		Wait:   30 * time.Second,
+
+		executor: executor.WithContext(ex),
+
+		log: log,
+	}
+}
+
+// Run claims and runs executions one at a time until ctx is done.
+func (w *Worker) Run(ctx context.Context) error {
+	for i := 0; ctx.Err() == nil; i++ {
+		endpoint := w.Endpoints[i%len(w.Endpoints)]
+
+		e, err := w.claim(ctx, endpoint)
+		if err != nil {
+			w.log.Error("could not claim execution", zap.String("worker", w.Name), zap.String("endpoint", endpoint), zap.Error(err))
+
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		if e != nil {
+			w.run(ctx, endpoint, e)
+		}
+	}
+	return ctx.Err()
+}
+
+func (w *Worker) run(ctx context.Context, endpoint string, e *remote.Execution) {
+	w.log.Info("running execution", zap.String("worker", w.Name), zap.String("execution", e.ID), zap.String("job_id", string(e.Job.ID)), zap.Int("attempt", e.Attempt))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go w.heartbeat(ctx, cancel, endpoint, e)
+
+	rm := &executor.RemoveRecorder{}
+	res, err := w.executor.ExecuteContext(ctx, &e.Job, rm)
+
+	req := &remote.CompleteRequest{
+		Worker: w.Name,
+		Result: res,
+		Remove: rm.Removed,
+	}
+	if err != nil {
+		req.Error = err.Error()
+	}
+
+	// the execution is lost once its lease expires, so there is no
+	// point in retrying for longer
+	lease := time.Duration(e.Lease) * time.Millisecond
+	err = utils.Backoff(100*time.Millisecond, lease, func() error {
+		err := w.post(context.Background(), endpoint+"/"+e.ID+"/complete", req, nil)
+		if err == remote.ErrLeaseLost {
+			// someone else is running it now
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		w.log.Error("could not complete execution", zap.String("worker", w.Name), zap.String("execution", e.ID), zap.Error(err))
+	}
+}
+
+// heartbeat keeps the execution leased, cancelling it once the lease is
+// lost
+func (w *Worker) heartbeat(ctx context.Context, cancel context.CancelFunc, endpoint string, e *remote.Execution) {
+	interval := time.Duration(e.Lease) * time.Millisecond / 3
+	if interval < minHeartbeat {
+		interval = minHeartbeat
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.post(ctx, endpoint+"/"+e.ID+"/heartbeat", &remote.HeartbeatRequest{Worker: w.Name}, nil)
+			if err == remote.ErrLeaseLost {
+				w.log.Info("execution lease lost", zap.String("worker", w.Name), zap.String("execution", e.ID))
+				cancel()
+				return
+			}
+			if err != nil {
+				w.log.Error("heartbeat failed", zap.String("worker", w.Name), zap.String("execution", e.ID), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (w *Worker) claim(ctx context.Context, endpoint string) (*remote.Execution, error) {
+	var e remote.Execution
+	req := &remote.ClaimRequest{
+		Worker: w.Name,
+		Kinds:  w.Kinds,
+		Wait:   int64(w.Wait / time.Millisecond),
+	}
+
+	err := w.post(ctx, endpoint+"/claim", req, &e)
+	if err == errNoContent {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e.Lease <= 0 {
+		return nil, ErrInvalidLease
+	}
+	return &e, nil
+}
+
+func (w *Worker) post(ctx context.Context, url string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return errNoContent
+	case http.StatusGone:
+		return remote.ErrLeaseLost
+	default:
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
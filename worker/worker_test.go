@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"github.com/mewa/djinn/djinn/job"
+	"github.com/mewa/djinn/executor"
+	"github.com/mewa/djinn/executor/remote"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newWorker(t *testing.T, ex executor.Executor) (*remote.Dispatcher, func()) {
+	disp := remote.NewDispatcher(zap.NewNop())
+	srv := httptest.NewServer(disp)
+
+	w := New("test-worker", []string{srv.URL}, ex, zap.NewNop())
+	w.Wait = 100 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go w.Run(ctx)
+
+	return disp, func() {
+		cancel()
+		srv.Close()
+	}
+}
+
+func Test_Worker_Execute(t *testing.T) {
+	disp, stop := newWorker(t, executor.ExecuteFunc(func(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+		return &job.Result{Output: string(j.ID)}, nil
+	}))
+	defer stop()
+
+	res, err := disp.ExecuteContext(context.Background(), &job.Job{ID: "test-worker-job"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Output != "test-worker-job" || res.Attempt != 1 {
+		t.Fatalf("invalid result: output='%s', attempt=%d", res.Output, res.Attempt)
+	}
+}
+
+func Test_Worker_Error(t *testing.T) {
+	disp, stop := newWorker(t, executor.ExecuteFunc(func(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+		return nil, errors.New("failed")
+	}))
+	defer stop()
+
+	_, err := disp.ExecuteContext(context.Background(), &job.Job{ID: "test-worker-job"}, nil)
+
+	execErr, ok := err.(*remote.ExecutionError)
+	if !ok || execErr.Worker != "test-worker" || execErr.Message != "failed" {
+		t.Fatalf("invalid error: %v", err)
+	}
+}
+
+type testRemover struct {
+	removed chan job.ID
+}
+
+func (rm *testRemover) Remove(j *job.Job) error {
+	rm.removed <- j.ID
+	return nil
+}
+
+func Test_Worker_Remove(t *testing.T) {
+	disp, stop := newWorker(t, executor.ExecuteFunc(func(ctx context.Context, j *job.Job, rm job.Remover) (*job.Result, error) {
+		return nil, rm.Remove(j)
+	}))
+	defer stop()
+
+	rm := &testRemover{make(chan job.ID, 1)}
+	_, err := disp.ExecuteContext(context.Background(), &job.Job{ID: "test-worker-job"}, rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case id := <-rm.removed:
+		if id != "test-worker-job" {
+			t.Fatalf("invalid job removed: %s", id)
+		}
+	default:
+		t.Fatal("job not removed")
+	}
+}
+
+func Test_Worker_InvalidLease(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "test-execution"}`))
+	}))
+	defer srv.Close()
+
+	w := New("test-worker", []string{srv.URL}, nil, zap.NewNop())
+
+	_, err := w.claim(context.Background(), srv.URL)
+	if err != ErrInvalidLease {
+		t.Fatalf("invalid error: expected='%v', actual='%v'", ErrInvalidLease, err)
+	}
+}